@@ -2,6 +2,7 @@
 
 set -euo pipefail
 
+# スキーマはマイグレーションのみで作成する. アプリケーションも起動時に未適用のマイグレーションを適用する
 sudo mycli -e "DROP DATABASE IF EXISTS isupipe"
 sudo mycli -e "CREATE DATABASE isupipe"
-cat $HOME/webapp/sql/initdb.d/10_schema.sql | sudo mycli
+cd $HOME/webapp/go && ./isupipe migrate up
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/isucon/isucon13/webapp/go/ngword"
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	adminTokenEnvKey = "ISUCON13_ADMIN_TOKEN"
+	adminTokenHeader = "X-Admin-Token"
+)
+
+type PostGlobalNGWordRequest struct {
+	NGWord string `json:"ng_word"`
+	// MatchMode substring(デフォルト), word, regex のいずれか
+	MatchMode string `json:"match_mode"`
+}
+
+// verifyAdmin 運営向けAPIの認証. 環境変数のトークンが未設定なら常に拒否する
+func verifyAdmin(c echo.Context) error {
+	token, ok := os.LookupEnv(adminTokenEnvKey)
+	if !ok || token == "" {
+		return echo.NewHTTPError(http.StatusForbidden, "admin API is disabled")
+	}
+	given := c.Request().Header.Get(adminTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return echo.NewHTTPError(http.StatusForbidden, "invalid admin token")
+	}
+	return nil
+}
+
+func getGlobalNGWordsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "getGlobalNGWordsHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyAdmin(c); err != nil {
+		return err
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	ngWords, err := tx.Moderation().ListNGWordsByScope(ctx, ngwordScopeGlobal, 0, 0)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, ngWords)
+}
+
+func postGlobalNGWordHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "postGlobalNGWordHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyAdmin(c); err != nil {
+		return err
+	}
+
+	var req *PostGlobalNGWordRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+
+	matchMode, err := ngword.ParseMode(req.MatchMode)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := ngword.Validate(ngword.Word{Text: req.NGWord, Mode: matchMode}); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// 全体NGワードは特定の配信者・配信に属さない
+	ngWord := &NGWord{
+		Word:      req.NGWord,
+		MatchMode: string(matchMode),
+		Scope:     ngwordScopeGlobal,
+		CreatedAt: time.Now().Unix(),
+	}
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := tx.Moderation().CreateNGWord(ctx, ngWord); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert new NG word: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	// 過去の投稿には遡らず、以降の投稿から適用する
+	invalidateNGWordMatcher(ctx, globalNGWordKey)
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"word_id": ngWord.ID,
+	})
+}
+
+func deleteGlobalNGWordHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "deleteGlobalNGWordHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyAdmin(c); err != nil {
+		return err
+	}
+
+	ngwordID, err := strconv.Atoi(c.Param("ngword_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "ngword_id in path must be integer")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	deleted, err := tx.Moderation().DeleteGlobalNGWord(ctx, int64(ngwordID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete NG word: "+err.Error())
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "not found NG word that has the given id")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	invalidateNGWordMatcher(ctx, globalNGWordKey)
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/isucon/isucon13/webapp/go/store"
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// BANの適用範囲
+	banScopeLivestream = "livestream"
+	banScopeChannel    = "channel"
+)
+
+type UserBanModel = store.UserBan
+
+type UserBan struct {
+	ID           int64  `json:"id"`
+	User         User   `json:"user"`
+	LivestreamID int64  `json:"livestream_id"`
+	Scope        string `json:"scope"`
+	Reason       string `json:"reason"`
+	CreatedAt    int64  `json:"created_at"`
+	ExpiresAt    *int64 `json:"expires_at"`
+}
+
+type PostUserBanRequest struct {
+	UserID int64 `json:"user_id"`
+	// Scope livestream(デフォルト)なら配信のみ、channelなら配信者の全配信
+	Scope string `json:"scope"`
+	// DurationSeconds 0なら無期限のBAN、正ならタイムアウト
+	DurationSeconds int64  `json:"duration_seconds"`
+	Reason          string `json:"reason"`
+}
+
+func getUserBansHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "getUserBansHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livestreamModel, err := authorizeModeration(ctx, tx, int64(livestreamID), userID, permissionBan)
+	if err != nil {
+		return err
+	}
+
+	// 配信に適用される有効なBANのみ返す
+	banModels, err := tx.Moderation().ListActiveBans(ctx, livestreamModel.UserID, livestreamModel.ID, time.Now().Unix())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get bans: "+err.Error())
+	}
+
+	bans := make([]UserBan, len(banModels))
+	for i := range banModels {
+		ban, err := fillUserBanResponse(ctx, tx, banModels[i])
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill ban: "+err.Error())
+		}
+		bans[i] = ban
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, bans)
+}
+
+func postUserBanHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "postUserBanHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostUserBanRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.UserID == userID {
+		return echo.NewHTTPError(http.StatusBadRequest, "can't ban yourself")
+	}
+	if req.DurationSeconds < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "duration_seconds must not be negative")
+	}
+
+	now := time.Now().Unix()
+	banModel := &UserBanModel{
+		UserID:       req.UserID,
+		LivestreamID: int64(livestreamID),
+		Scope:        banScopeLivestream,
+		Reason:       req.Reason,
+		CreatedBy:    userID,
+		CreatedAt:    now,
+	}
+	switch req.Scope {
+	case "", banScopeLivestream:
+	case banScopeChannel:
+		banModel.LivestreamID = 0
+		banModel.Scope = banScopeChannel
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "scope must be livestream or channel")
+	}
+	if req.DurationSeconds > 0 {
+		banModel.ExpiresAt = sql.NullInt64{Int64: now + req.DurationSeconds, Valid: true}
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livestreamModel, err := authorizeModeration(ctx, tx, int64(livestreamID), userID, permissionBan)
+	if err != nil {
+		return err
+	}
+	// チャンネル全体のBANはチャンネルのモデレーターのみ行える
+	if banModel.Scope == banScopeChannel {
+		if err := authorizeChannelModeration(ctx, tx, livestreamModel.UserID, userID, permissionBan); err != nil {
+			return err
+		}
+	}
+	if req.UserID == livestreamModel.UserID {
+		return echo.NewHTTPError(http.StatusBadRequest, "can't ban the streamer")
+	}
+	banModel.StreamerID = livestreamModel.UserID
+
+	if _, err := tx.Users().GetUserByID(ctx, req.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
+	}
+
+	if err := tx.Moderation().CreateBan(ctx, banModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert ban: "+err.Error())
+	}
+
+	ban, err := fillUserBanResponse(ctx, tx, *banModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill ban: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, ban)
+}
+
+// deleteUserBanHandler BANやタイムアウトを解除する
+func deleteUserBanHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "deleteUserBanHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	banID, err := strconv.Atoi(c.Param("ban_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "ban_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livestreamModel, err := authorizeModeration(ctx, tx, int64(livestreamID), userID, permissionBan)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := tx.Moderation().DeleteBan(ctx, int64(banID), livestreamModel.UserID, livestreamModel.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete ban: "+err.Error())
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "ban not found")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// verifyNotBanned 配信またはチャンネルからBAN・タイムアウトされていれば403を返す.
+// 配信が存在しない場合の扱いは呼び出し側に任せる
+func verifyNotBanned(ctx context.Context, tx store.Tx, userID int64, livestreamID int64) error {
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, livestreamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+	banModels, err := tx.Moderation().ListActiveBansForUser(ctx, userID, livestreamModel.UserID, livestreamModel.ID, time.Now().Unix())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get bans: "+err.Error())
+	}
+	if len(banModels) == 0 {
+		return nil
+	}
+
+	// 無期限のBANがあればタイムアウトより優先する
+	var until int64
+	for _, banModel := range banModels {
+		if !banModel.ExpiresAt.Valid {
+			return echo.NewHTTPError(http.StatusForbidden, "you are banned from this livestream")
+		}
+		until = max(until, banModel.ExpiresAt.Int64)
+	}
+	return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("you are timed out from this livestream until %d", until))
+}
+
+func fillUserBanResponse(ctx context.Context, tx store.Tx, banModel UserBanModel) (UserBan, error) {
+	userModel, err := tx.Users().GetUserByID(ctx, banModel.UserID)
+	if err != nil {
+		return UserBan{}, err
+	}
+	user, err := fillUserResponse(ctx, tx, userModel)
+	if err != nil {
+		return UserBan{}, err
+	}
+
+	ban := UserBan{
+		ID:           banModel.ID,
+		User:         user,
+		LivestreamID: banModel.LivestreamID,
+		Scope:        banModel.Scope,
+		Reason:       banModel.Reason,
+		CreatedAt:    banModel.CreatedAt,
+		ExpiresAt:    nullInt64Ptr(banModel.ExpiresAt),
+	}
+	return ban, nil
+}
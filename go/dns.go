@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+)
+
+// dnsZone ユーザごとのサブドメインを登録するDNSゾーン
+// テストではpdnsutilを呼ばない実装に差し替える
+type dnsZone interface {
+	// AddRecord ユーザ名のAレコードを追加する
+	AddRecord(ctx context.Context, name string) error
+	// Reset 初期データのユーザのレコードだけを持つ状態に戻す
+	Reset(ctx context.Context) error
+}
+
+// pdnsutilZone PowerDNSのpdnsutilでゾーンを操作する
+type pdnsutilZone struct {
+	zone    string
+	address string
+	// zoneFile Reset時に読み込むゾーンファイル. アドレスは<ISUCON_SUBDOMAIN_ADDRESS>と書いておく
+	zoneFile string
+}
+
+func (z *pdnsutilZone) AddRecord(ctx context.Context, name string) error {
+	if out, err := exec.CommandContext(ctx, "pdnsutil", "add-record", z.zone, name, "A", "0", z.address).CombinedOutput(); err != nil {
+		return &commandError{out: out, err: err}
+	}
+	return nil
+}
+
+func (z *pdnsutilZone) Reset(ctx context.Context) error {
+	template, err := os.ReadFile(z.zoneFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "zone")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(bytes.ReplaceAll(template, []byte("<ISUCON_SUBDOMAIN_ADDRESS>"), []byte(z.address)))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if out, err := exec.CommandContext(ctx, "pdnsutil", "load-zone", z.zone, f.Name()).CombinedOutput(); err != nil {
+		return &commandError{out: out, err: err}
+	}
+	return nil
+}
+
+// noopZone DNSを使わない環境向け. サブドメインを登録せずに成功する
+type noopZone struct{}
+
+func (noopZone) AddRecord(ctx context.Context, name string) error { return nil }
+func (noopZone) Reset(ctx context.Context) error                  { return nil }
+
+// commandError 外部コマンドの出力をエラーメッセージに含める
+type commandError struct {
+	out []byte
+	err error
+}
+
+func (e *commandError) Error() string {
+	return string(e.out) + ": " + e.err.Error()
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
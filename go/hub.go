@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	eventLivecomment        = "livecomment"
+	eventLivecommentDeleted = "livecomment_deleted"
+	eventLivecommentEdited  = "livecomment_edited"
+	eventLivecommentPinned  = "livecomment_pinned"
+	eventReaction           = "reaction"
+	eventViewers            = "viewers"
+
+	// 購読者ごとのバッファ. 溢れた購読者は切断し、クライアントの再接続に任せる
+	subscriberBufferSize = 64
+
+	// 複数のアプリケーションサーバへ配るためのRedis pub/subチャンネル
+	livestreamEventChannelPrefix = "livestream:events:"
+)
+
+type livestreamEvent struct {
+	LivestreamID int64  `json:"livestream_id"`
+	Type         string `json:"type"`
+	// ID はSSEのidとして使う. livecommentイベントのみlivecomment idが入る
+	ID   int64           `json:"id,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+type livestreamSubscriber struct {
+	livestreamID int64
+	events       chan livestreamEvent
+	dropped      chan struct{}
+	dropOnce     sync.Once
+}
+
+func (s *livestreamSubscriber) drop() {
+	s.dropOnce.Do(func() { close(s.dropped) })
+}
+
+// livestreamHub ライブ配信ごとにイベントを購読者へ配信する
+type livestreamHub struct {
+	mu          sync.RWMutex
+	subscribers map[int64]map[*livestreamSubscriber]struct{}
+}
+
+var eventHub = newLivestreamHub()
+
+func newLivestreamHub() *livestreamHub {
+	return &livestreamHub{
+		subscribers: make(map[int64]map[*livestreamSubscriber]struct{}),
+	}
+}
+
+func (h *livestreamHub) subscribe(livestreamID int64) *livestreamSubscriber {
+	s := &livestreamSubscriber{
+		livestreamID: livestreamID,
+		events:       make(chan livestreamEvent, subscriberBufferSize),
+		dropped:      make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[livestreamID]; !ok {
+		h.subscribers[livestreamID] = make(map[*livestreamSubscriber]struct{})
+	}
+	h.subscribers[livestreamID][s] = struct{}{}
+	return s
+}
+
+func (h *livestreamHub) unsubscribe(s *livestreamSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs, ok := h.subscribers[s.livestreamID]
+	if !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(h.subscribers, s.livestreamID)
+	}
+}
+
+// publish Redis経由で全アプリケーションサーバの購読者へ配信する
+func (h *livestreamHub) publish(ctx context.Context, ev livestreamEvent) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("failed to marshal livestream event: %v", err)
+		return
+	}
+	channel := livestreamEventChannelPrefix + strconv.FormatInt(ev.LivestreamID, 10)
+	if err := rdb.Publish(ctx, channel, payload).Err(); err != nil {
+		// Redisが使えなくても、少なくとも自サーバの購読者には届ける
+		log.Printf("failed to publish livestream event to redis: %v", err)
+		h.dispatch(ev)
+	}
+}
+
+// dispatch 遅い購読者で配信全体が詰まらないよう、送れなかった購読者は切断する
+func (h *livestreamHub) dispatch(ev livestreamEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subscribers[ev.LivestreamID] {
+		select {
+		case s.events <- ev:
+		default:
+			s.drop()
+		}
+	}
+}
+
+// run Redisに流れてくるイベントを自サーバの購読者へ配る
+func (h *livestreamHub) run(ctx context.Context) {
+	pubsub := rdb.PSubscribe(ctx, livestreamEventChannelPrefix+"*")
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		if !strings.HasPrefix(msg.Channel, livestreamEventChannelPrefix) {
+			continue
+		}
+		var ev livestreamEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+			log.Printf("failed to unmarshal livestream event: %v", err)
+			continue
+		}
+		h.dispatch(ev)
+	}
+}
+
+func publishLivecomment(ctx context.Context, livecomment Livecomment) error {
+	data, err := json.Marshal(livecomment)
+	if err != nil {
+		return err
+	}
+	eventHub.publish(ctx, livestreamEvent{
+		LivestreamID: livecomment.Livestream.ID,
+		Type:         eventLivecomment,
+		ID:           livecomment.ID,
+		Data:         data,
+	})
+	return nil
+}
+
+func publishLivecommentDeleted(ctx context.Context, livestreamID int64, livecommentID int64) error {
+	data, err := json.Marshal(map[string]int64{
+		"id": livecommentID,
+	})
+	if err != nil {
+		return err
+	}
+	eventHub.publish(ctx, livestreamEvent{
+		LivestreamID: livestreamID,
+		Type:         eventLivecommentDeleted,
+		Data:         data,
+	})
+	return nil
+}
+
+// publishLivecommentEdited 編集はLast-Event-IDでの再開対象にしないため、idを付けない
+func publishLivecommentEdited(ctx context.Context, livecomment Livecomment) error {
+	data, err := json.Marshal(livecomment)
+	if err != nil {
+		return err
+	}
+	eventHub.publish(ctx, livestreamEvent{
+		LivestreamID: livecomment.Livestream.ID,
+		Type:         eventLivecommentEdited,
+		Data:         data,
+	})
+	return nil
+}
+
+// publishLivecommentPinned 固定が解除された場合はlivecommentをnilにする
+func publishLivecommentPinned(ctx context.Context, livestreamID int64, livecomment *Livecomment) error {
+	data, err := json.Marshal(map[string]*Livecomment{
+		"livecomment": livecomment,
+	})
+	if err != nil {
+		return err
+	}
+	eventHub.publish(ctx, livestreamEvent{
+		LivestreamID: livestreamID,
+		Type:         eventLivecommentPinned,
+		Data:         data,
+	})
+	return nil
+}
+
+func publishReaction(ctx context.Context, reaction Reaction) error {
+	data, err := json.Marshal(reaction)
+	if err != nil {
+		return err
+	}
+	eventHub.publish(ctx, livestreamEvent{
+		LivestreamID: reaction.Livestream.ID,
+		Type:         eventReaction,
+		Data:         data,
+	})
+	return nil
+}
+
+func publishViewersCount(ctx context.Context, livestreamID int64, viewersCount int64) error {
+	data, err := json.Marshal(map[string]int64{
+		"viewers_count": viewersCount,
+	})
+	if err != nil {
+		return err
+	}
+	eventHub.publish(ctx, livestreamEvent{
+		LivestreamID: livestreamID,
+		Type:         eventViewers,
+		Data:         data,
+	})
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/isucon/isucon13/webapp/go/migrate"
+	"github.com/isucon/isucon13/webapp/go/seed"
+	"github.com/labstack/echo/v4"
+)
+
+// initializeTimeout ベンチマーカーが/api/initializeを待つのは42秒まで
+const initializeTimeout = 40 * time.Second
+
+type initializeStep struct {
+	name string
+	run  func(ctx context.Context, logger echo.Logger) error
+}
+
+// initializeSteps 以前の../sql/init.shと同じ処理を、外部コマンドを使わずに行う
+var initializeSteps = []initializeStep{
+	// 環境ごとにスキーマがずれないよう、初期データを入れる前に未適用のマイグレーションを適用する
+	{name: "migrate", run: applyMigrations},
+	{name: "seed", run: func(ctx context.Context, logger echo.Logger) error {
+		return seed.Load(ctx, dbConn, func(file string, statements int, elapsed time.Duration) {
+			logger.Infof("initialize: loaded %s (%d statements) in %s", file, statements, elapsed)
+		})
+	}},
+	{name: "icons", run: func(ctx context.Context, logger echo.Logger) error {
+		return os.RemoveAll("public/icons/users/")
+	}},
+	{name: "redis", run: func(ctx context.Context, logger echo.Logger) error {
+		return rdb.FlushDB(ctx).Err()
+	}},
+	{name: "dns", run: func(ctx context.Context, logger echo.Logger) error {
+		return subdomainZone.Reset(ctx)
+	}},
+}
+
+// applyMigrations 未適用のマイグレーションを適用する. 起動時と/api/initializeで呼ぶ
+func applyMigrations(ctx context.Context, logger echo.Logger) error {
+	migrator, err := migrate.New(dbConn)
+	if err != nil {
+		return err
+	}
+	done, err := migrator.Up(ctx)
+	for _, m := range done {
+		logger.Infof("applied migration %04d_%s", m.Version, m.Name)
+	}
+	return err
+}
+
+// initializeData データを初期状態に戻す. 各段階の所要時間をログに出す
+func initializeData(ctx context.Context, logger echo.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, initializeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	for _, step := range initializeSteps {
+		stepStart := time.Now()
+		if err := step.run(ctx, logger); err != nil {
+			return fmt.Errorf("%s: %w", step.name, err)
+		}
+		logger.Infof("initialize: %s done in %s", step.name, time.Since(stepStart))
+	}
+	purgeNGWordMatchers(ctx)
+	logger.Infof("initialize: completed in %s", time.Since(start))
+	return nil
+}
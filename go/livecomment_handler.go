@@ -4,14 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/goccy/go-json"
+	"github.com/isucon/isucon13/webapp/go/ngword"
+	"github.com/isucon/isucon13/webapp/go/store"
 	"github.com/isucon/isucon13/webapp/go/trace"
-	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
@@ -21,15 +23,16 @@ type PostLivecommentRequest struct {
 	Tip     int64  `json:"tip"`
 }
 
-type LivecommentModel struct {
-	ID           int64  `db:"id"`
-	UserID       int64  `db:"user_id"`
-	LivestreamID int64  `db:"livestream_id"`
-	Comment      string `db:"comment"`
-	Tip          int64  `db:"tip"`
-	CreatedAt    int64  `db:"created_at"`
+// PatchLivecommentRequest チップは投稿後に変更できない
+type PatchLivecommentRequest struct {
+	Comment string `json:"comment"`
 }
 
+// 投稿者がライブコメントを編集・削除できる期間
+const livecommentEditWindow = 5 * time.Minute
+
+type LivecommentModel = store.Livecomment
+
 type Livecomment struct {
 	ID         int64      `json:"id"`
 	User       User       `json:"user"`
@@ -37,6 +40,17 @@ type Livecomment struct {
 	Comment    string     `json:"comment"`
 	Tip        int64      `json:"tip"`
 	CreatedAt  int64      `json:"created_at"`
+	EditedAt   *int64     `json:"edited_at"`
+	// Pinned 配信者によって配信の上部に固定されている
+	Pinned bool `json:"pinned"`
+	// HighlightUntil チップ付きライブコメントをハイライトする期限. チップがなければnull
+	HighlightUntil *int64 `json:"highlight_until"`
+}
+
+// LivecommentsPage before/after指定時のライブコメント一覧
+type LivecommentsPage struct {
+	Livecomments []Livecomment `json:"livecomments"`
+	NextCursor   *string       `json:"next_cursor"`
 }
 
 type LivecommentReport struct {
@@ -44,27 +58,25 @@ type LivecommentReport struct {
 	Reporter    User        `json:"reporter"`
 	Livecomment Livecomment `json:"livecomment"`
 	CreatedAt   int64       `json:"created_at"`
+	// Status open, dismissed, actioned のいずれか
+	Status     string  `json:"status"`
+	Action     *string `json:"action"`
+	ResolvedAt *int64  `json:"resolved_at"`
+	// AutoHidden 報告数がしきい値に達して自動で非表示になっている
+	AutoHidden bool `json:"auto_hidden"`
 }
 
-type LivecommentReportModel struct {
-	ID            int64 `db:"id"`
-	UserID        int64 `db:"user_id"`
-	LivestreamID  int64 `db:"livestream_id"`
-	LivecommentID int64 `db:"livecomment_id"`
-	CreatedAt     int64 `db:"created_at"`
-}
+type LivecommentReportModel = store.LivecommentReport
 
 type ModerateRequest struct {
 	NGWord string `json:"ng_word"`
+	// MatchMode substring(デフォルト), word, regex のいずれか
+	MatchMode string `json:"match_mode"`
+	// Scope livestream(デフォルト)なら配信のみ、channelなら配信者の全配信に適用する
+	Scope string `json:"scope"`
 }
 
-type NGWord struct {
-	ID           int64  `json:"id" db:"id"`
-	UserID       int64  `json:"user_id" db:"user_id"`
-	LivestreamID int64  `json:"livestream_id" db:"livestream_id"`
-	Word         string `json:"word" db:"word"`
-	CreatedAt    int64  `json:"created_at" db:"created_at"`
-}
+type NGWord = store.NGWord
 
 func getLivecommentsHandler(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -81,45 +93,49 @@ func getLivecommentsHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	query := "SELECT * FROM livecomments WHERE livestream_id = ? ORDER BY created_at DESC"
-	if c.QueryParam("limit") != "" {
-		limit, err := strconv.Atoi(c.QueryParam("limit"))
-		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer")
-		}
-		query += fmt.Sprintf(" LIMIT %d", limit)
-	}
-
-	livecommentModels := []LivecommentModel{}
-	err = tx.SelectContext(ctx, &livecommentModels, query, livestreamID)
-	if errors.Is(err, sql.ErrNoRows) {
-		return c.JSON(http.StatusOK, []*Livecomment{})
-	}
+	page, err := parsePageQuery(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
+		return err
 	}
-
-	livecomments := make([]Livecomment, len(livecommentModels))
-	for i := range livecommentModels {
-		livecomment, err := fillLivecommentResponse(ctx, tx, livecommentModels[i])
+	livecommentModels := []LivecommentModel{}
+	if !page.Empty {
+		livecommentModels, err = tx.Livecomments().ListVisibleLivecomments(ctx, int64(livestreamID), page.storePage())
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fil livecomments: "+err.Error())
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
 		}
+	}
+	if page.After != nil {
+		slices.Reverse(livecommentModels)
+	}
 
-		livecomments[i] = livecomment
+	livecomments, err := fillLivecommentResponses(ctx, tx, livecommentModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fil livecomments: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
-	return c.JSON(http.StatusOK, livecomments)
+	if !page.Paginated {
+		return c.JSON(http.StatusOK, livecomments)
+	}
+
+	var newest, oldest pageCursor
+	if n := len(livecommentModels); n > 0 {
+		newest = pageCursor{CreatedAt: livecommentModels[0].CreatedAt, ID: livecommentModels[0].ID}
+		oldest = pageCursor{CreatedAt: livecommentModels[n-1].CreatedAt, ID: livecommentModels[n-1].ID}
+	}
+	return c.JSON(http.StatusOK, &LivecommentsPage{
+		Livecomments: livecomments,
+		NextCursor:   page.nextCursor(len(livecommentModels), newest, oldest),
+	})
 }
 
 func getNgwords(c echo.Context) error {
@@ -141,19 +157,22 @@ func getNgwords(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	var ngWords []*NGWord
-	if err := tx.SelectContext(ctx, &ngWords, "SELECT * FROM ng_words WHERE user_id = ? AND livestream_id = ? ORDER BY created_at DESC", userID, livestreamID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return c.JSON(http.StatusOK, []*NGWord{})
-		} else {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error())
-		}
+	// 配信者自身か、NGワードを管理できるモデレーターのみ取得できる
+	livestreamModel, err := getModeratableLivestream(ctx, tx, int64(livestreamID), userID)
+	if err != nil {
+		return err
+	}
+
+	// 配信に適用される全てのNGワードを、どの範囲のものか分かるように返す
+	ngWords, err := tx.Moderation().ListNGWords(ctx, livestreamModel.UserID, livestreamModel.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -189,14 +208,14 @@ func postLivecommentHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	var livestreamModel LivestreamModel
-	if err := tx.GetContext(ctx, &livestreamModel, "SELECT id, user_id FROM livestreams WHERE id = ?", livestreamID); err != nil {
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, int64(livestreamID))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
 		} else {
@@ -204,28 +223,29 @@ func postLivecommentHandler(c echo.Context) error {
 		}
 	}
 
+	if err := verifyNotBanned(ctx, tx, userID, livestreamModel.ID); err != nil {
+		return err
+	}
+
 	// スパム判定
-	var ngwords []*NGWord
-	if err := tx.SelectContext(ctx, &ngwords, "SELECT id, user_id, livestream_id, word FROM ng_words WHERE user_id = ? AND livestream_id = ?", livestreamModel.UserID, livestreamModel.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+	hitWord, hit, err := matchNGWords(ctx, livestreamModel, req.Comment)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error())
 	}
+	if hit {
+		c.Logger().Infof("[hitSpam ng_word_id=%d] comment = %s", hitWord.ID, req.Comment)
+		return echo.NewHTTPError(http.StatusBadRequest, "このコメントがスパム判定されました")
+	}
 
-	var hitSpam int
-	for _, ngword := range ngwords {
-		query := `
-		SELECT COUNT(*)
-		FROM
-		(SELECT ? AS text) AS texts
-		INNER JOIN
-		(SELECT CONCAT('%', ?, '%')	AS pattern) AS patterns
-		ON texts.text LIKE patterns.pattern;
-		`
-		if err := tx.GetContext(ctx, &hitSpam, query, req.Comment, ngword.Word); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get hitspam: "+err.Error())
-		}
-		c.Logger().Infof("[hitSpam=%d] comment = %s", hitSpam, req.Comment)
-		if hitSpam >= 1 {
-			return echo.NewHTTPError(http.StatusBadRequest, "このコメントがスパム判定されました")
+	// 配信者とモデレーターには投稿の制限をかけない.
+	// 投稿されないコメントでトークンを消費しないよう、スパム判定の後に確認する
+	exempt, err := isModerator(ctx, tx, livestreamModel.UserID, livestreamModel.ID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+	}
+	if !exempt {
+		if err := limitLivecommentRate(c, tx, livestreamModel.ID, userID); err != nil {
+			return err
 		}
 	}
 
@@ -238,17 +258,10 @@ func postLivecommentHandler(c echo.Context) error {
 		CreatedAt:    now,
 	}
 
-	rs, err := tx.NamedExecContext(ctx, "INSERT INTO livecomments (user_id, livestream_id, comment, tip, created_at) VALUES (:user_id, :livestream_id, :comment, :tip, :created_at)", livecommentModel)
-	if err != nil {
+	if err := tx.Livecomments().CreateLivecomment(ctx, &livecommentModel); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livecomment: "+err.Error())
 	}
 
-	livecommentID, err := rs.LastInsertId()
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted livecomment id: "+err.Error())
-	}
-	livecommentModel.ID = livecommentID
-
 	livecomment, err := fillLivecommentResponse(ctx, tx, livecommentModel)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment: "+err.Error())
@@ -262,9 +275,163 @@ func postLivecommentHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to set tip(redis): "+err.Error())
 	}
 
+	if err := publishLivecomment(ctx, livecomment); err != nil {
+		c.Logger().Warnf("failed to publish livecomment: %v", err)
+	}
+
 	return c.JSON(http.StatusCreated, livecomment)
 }
 
+// PATCH /api/livestream/:livestream_id/livecomment/:livecomment_id
+func patchLivecommentHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "patchLivecommentHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	livecommentID, err := strconv.Atoi(c.Param("livecomment_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livecomment_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PatchLivecommentRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livecommentModel, err := getEditableLivecomment(ctx, tx, int64(livestreamID), int64(livecommentID), userID)
+	if err != nil {
+		return err
+	}
+
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, int64(livestreamID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+
+	// 編集後のコメントもスパム判定する
+	hitWord, hit, err := matchNGWords(ctx, livestreamModel, req.Comment)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error())
+	}
+	if hit {
+		c.Logger().Infof("[hitSpam ng_word_id=%d] comment = %s", hitWord.ID, req.Comment)
+		return echo.NewHTTPError(http.StatusBadRequest, "このコメントがスパム判定されました")
+	}
+
+	livecommentModel.Comment = req.Comment
+	livecommentModel.EditedAt = sql.NullInt64{Int64: time.Now().Unix(), Valid: true}
+	if err := tx.Livecomments().UpdateLivecomment(ctx, &livecommentModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update livecomment: "+err.Error())
+	}
+
+	livecomment, err := fillLivecommentResponse(ctx, tx, livecommentModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	if err := publishLivecommentEdited(ctx, livecomment); err != nil {
+		c.Logger().Warnf("failed to publish livecomment edit: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, livecomment)
+}
+
+// DELETE /api/livestream/:livestream_id/livecomment/:livecomment_id
+// チップを売上として残すため、削除せずに非表示にする
+func deleteLivecommentHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "deleteLivecommentHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	livecommentID, err := strconv.Atoi(c.Param("livecomment_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livecomment_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livecommentModel, err := getEditableLivecomment(ctx, tx, int64(livestreamID), int64(livecommentID), userID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Livecomments().HideLivecommentByAuthor(ctx, livecommentModel.ID, time.Now().Unix(), hiddenReasonAuthorDeleted); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livecomment: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	if err := publishLivecommentDeleted(ctx, livecommentModel.LivestreamID, livecommentModel.ID); err != nil {
+		c.Logger().Warnf("failed to publish livecomment deletion: %v", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getEditableLivecomment 投稿者本人が編集期間内に操作していることを検証してライブコメントを返す
+func getEditableLivecomment(ctx context.Context, tx store.Tx, livestreamID int64, livecommentID int64, userID int64) (LivecommentModel, error) {
+	livecommentModel, err := tx.Livecomments().GetLivecommentForUpdate(ctx, livecommentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return LivecommentModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment: "+err.Error())
+	}
+	if err != nil || livecommentModel.LivestreamID != livestreamID || livecommentModel.HiddenAt.Valid {
+		return LivecommentModel{}, echo.NewHTTPError(http.StatusNotFound, "livecomment not found")
+	}
+	if livecommentModel.UserID != userID {
+		return LivecommentModel{}, echo.NewHTTPError(http.StatusForbidden, "can't edit other user's livecomment")
+	}
+	if time.Since(time.Unix(livecommentModel.CreatedAt, 0)) > livecommentEditWindow {
+		return LivecommentModel{}, echo.NewHTTPError(http.StatusForbidden, "edit window has passed")
+	}
+	return livecommentModel, nil
+}
+
 func reportLivecommentHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	trace.StartSpan(ctx, "reportLivecommentHandler")
@@ -289,14 +456,13 @@ func reportLivecommentHandler(c echo.Context) error {
 	// existence already checked
 	userID := sess.Values[defaultUserIDKey].(int64)
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	var livestreamModel LivestreamModel
-	if err := tx.GetContext(ctx, &livestreamModel, "SELECT id FROM livestreams WHERE id = ?", livestreamID); err != nil {
+	if _, err := tx.Livestreams().GetLivestreamByID(ctx, int64(livestreamID)); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
 		} else {
@@ -304,13 +470,12 @@ func reportLivecommentHandler(c echo.Context) error {
 		}
 	}
 
-	var livecommentModel LivecommentModel
-	if err := tx.GetContext(ctx, &livecommentModel, "SELECT id FROM livecomments WHERE id = ?", livecommentID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusNotFound, "livecomment not found")
-		} else {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment: "+err.Error())
-		}
+	livecommentModel, err := tx.Livecomments().GetLivecommentByID(ctx, int64(livecommentID))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment: "+err.Error())
+	}
+	if err != nil || livecommentModel.HiddenAt.Valid {
+		return echo.NewHTTPError(http.StatusNotFound, "livecomment not found")
 	}
 
 	now := time.Now().Unix()
@@ -319,16 +484,21 @@ func reportLivecommentHandler(c echo.Context) error {
 		LivestreamID:  int64(livestreamID),
 		LivecommentID: int64(livecommentID),
 		CreatedAt:     now,
+		Status:        reportStatusOpen,
 	}
-	rs, err := tx.NamedExecContext(ctx, "INSERT INTO livecomment_reports(user_id, livestream_id, livecomment_id, created_at) VALUES (:user_id, :livestream_id, :livecomment_id, :created_at)", &reportModel)
-	if err != nil {
+	// 同じユーザが同じライブコメントを何度も報告できないよう、一意制約で弾く
+	if err := tx.Livecomments().CreateReport(ctx, &reportModel); err != nil {
+		if errors.Is(err, store.ErrDuplicate) {
+			return echo.NewHTTPError(http.StatusConflict, "you have already reported this livecomment")
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livecomment report: "+err.Error())
 	}
-	reportID, err := rs.LastInsertId()
+
+	// 報告数が配信ごとのしきい値に達したら、配信者の確認を待たずに非表示にする
+	autoHidden, err := autoHideReportedLivecomment(ctx, tx, int64(livestreamID), int64(livecommentID))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted livecomment report id: "+err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to auto-hide livecomment: "+err.Error())
 	}
-	reportModel.ID = reportID
 
 	report, err := fillLivecommentReportResponse(ctx, tx, reportModel)
 	if err != nil {
@@ -338,6 +508,12 @@ func reportLivecommentHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
+	if autoHidden {
+		if err := publishLivecommentDeleted(ctx, int64(livestreamID), int64(livecommentID)); err != nil {
+			c.Logger().Warnf("failed to publish livecomment deletion: %v", err)
+		}
+	}
+
 	return c.JSON(http.StatusCreated, report)
 }
 
@@ -368,99 +544,390 @@ func moderateHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	matchMode, err := ngword.ParseMode(req.MatchMode)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := ngword.Validate(ngword.Word{Text: req.NGWord, Mode: matchMode}); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ngWord := &NGWord{
+		LivestreamID: int64(livestreamID),
+		Word:         req.NGWord,
+		MatchMode:    string(matchMode),
+		Scope:        ngwordScopeLivestream,
+		CreatedAt:    time.Now().Unix(),
+	}
+	switch req.Scope {
+	case "", ngwordScopeLivestream:
+	case ngwordScopeChannel:
+		ngWord.LivestreamID = 0
+		ngWord.Scope = ngwordScopeChannel
+	default:
+		// 全体NGワードは運営のみ登録できる
+		return echo.NewHTTPError(http.StatusBadRequest, "scope must be livestream or channel")
+	}
+
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	// 配信者自身の配信に対するmoderateなのかを検証
-	var ownedLivestreams []LivestreamModel
-	if err := tx.SelectContext(ctx, &ownedLivestreams, "SELECT * FROM livestreams WHERE id = ? AND user_id = ?", livestreamID, userID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
+	// 配信者自身か、NGワードを管理できるモデレーターによるmoderateなのかを検証
+	livestreamModel, err := getModeratableLivestream(ctx, tx, int64(livestreamID), userID)
+	if err != nil {
+		// 既存のクライアントのため、配信がない場合も権限がない場合も従来通り400を返す
+		var he *echo.HTTPError
+		if errors.As(err, &he) && (he.Code == http.StatusNotFound || he.Code == http.StatusForbidden) {
+			return echo.NewHTTPError(http.StatusBadRequest, "A streamer can't moderate livestreams that other streamers own")
+		}
+		return err
+	}
+	// チャンネル全体のNGワードはチャンネルのモデレーターのみ登録できる
+	if ngWord.Scope == ngwordScopeChannel {
+		if err := authorizeChannelModeration(ctx, tx, livestreamModel.UserID, userID, permissionManageNGWords); err != nil {
+			return err
+		}
+	}
+	// NGワードは配信者のものとして登録する
+	ngWord.UserID = livestreamModel.UserID
+
+	if err := tx.Moderation().CreateNGWord(ctx, ngWord); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert new NG word: "+err.Error())
 	}
-	if len(ownedLivestreams) == 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, "A streamer can't moderate livestreams that other streamers own")
+
+	// NGワードにヒットする過去の投稿も全て非表示にする
+	hiddenLivecommentIDs, err := hideLivecommentsForNGWord(ctx, tx, ngWord, moderationActionNGWordAdded, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to hide old livecomments that hit spams: "+err.Error())
 	}
 
-	rs, err := tx.NamedExecContext(ctx, "INSERT INTO ng_words(user_id, livestream_id, word, created_at) VALUES (:user_id, :livestream_id, :word, :created_at)", &NGWord{
-		UserID:       int64(userID),
-		LivestreamID: int64(livestreamID),
-		Word:         req.NGWord,
-		CreatedAt:    time.Now().Unix(),
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	invalidateNGWordMatcher(ctx, ngwordMatcherKey(ngWord))
+	publishHiddenLivecomments(ctx, hiddenLivecommentIDs)
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"word_id": ngWord.ID,
 	})
+}
+
+// NGワードを修正
+// PUT /api/livestream/:livestream_id/ngwords/:ngword_id
+func updateNgwordHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "updateNgwordHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert new NG word: "+err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	wordID, err := rs.LastInsertId()
+	ngwordID, err := strconv.Atoi(c.Param("ngword_id"))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted NG word id: "+err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, "ngword_id in path must be integer")
 	}
 
-	var ngwords []*NGWord
-	if err := tx.SelectContext(ctx, &ngwords, "SELECT * FROM ng_words WHERE livestream_id = ?", livestreamID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error())
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *ModerateRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
 
-	// NGワードにヒットする過去の投稿も全削除する
-	for _, ngword := range ngwords {
-		// ライブコメント一覧取得
-		var livecomments []*LivecommentModel
-		if err := tx.SelectContext(ctx, &livecomments, "SELECT * FROM livecomments"); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
-		}
+	matchMode, err := ngword.ParseMode(req.MatchMode)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := ngword.Validate(ngword.Word{Text: req.NGWord, Mode: matchMode}); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 
-		for _, livecomment := range livecomments {
-			query := `
-			DELETE FROM livecomments
-			WHERE
-			id = ? AND
-			livestream_id = ? AND
-			(SELECT COUNT(*)
-			FROM
-			(SELECT ? AS text) AS texts
-			INNER JOIN
-			(SELECT CONCAT('%', ?, '%')	AS pattern) AS patterns
-			ON texts.text LIKE patterns.pattern) >= 1;
-			`
-			if _, err := tx.ExecContext(ctx, query, livecomment.ID, livestreamID, livecomment.Comment, ngword.Word); err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete old livecomments that hit spams: "+err.Error())
-			}
-		}
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	ngWord, err := getModeratableNGWord(ctx, tx, int64(livestreamID), int64(ngwordID), userID)
+	if err != nil {
+		return err
+	}
+
+	ngWord.Word = req.NGWord
+	ngWord.MatchMode = string(matchMode)
+	if err := tx.Moderation().UpdateNGWord(ctx, ngWord); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update NG word: "+err.Error())
+	}
+
+	// 修正後のNGワードにヒットする過去の投稿も非表示にする
+	hiddenLivecommentIDs, err := hideLivecommentsForNGWord(ctx, tx, ngWord, moderationActionNGWordUpdated, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to hide old livecomments that hit spams: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
-	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"word_id": wordID,
-	})
+	invalidateNGWordMatcher(ctx, ngwordMatcherKey(ngWord))
+	publishHiddenLivecomments(ctx, hiddenLivecommentIDs)
+
+	return c.JSON(http.StatusOK, ngWord)
 }
 
-func fillLivecommentResponse(ctx context.Context, tx *sqlx.Tx, livecommentModel LivecommentModel) (Livecomment, error) {
-	trace.StartSpan(ctx, "fillLivecommentResponse")
+// NGワードを削除
+// DELETE /api/livestream/:livestream_id/ngwords/:ngword_id
+func deleteNgwordHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "deleteNgwordHandler")
 	defer trace.EndSpan(ctx, nil)
 
-	commentOwnerModel := UserModel{}
-	if err := tx.GetContext(ctx, &commentOwnerModel, "SELECT * FROM users WHERE id = ?", livecommentModel.UserID); err != nil {
-		return Livecomment{}, err
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
-	commentOwner, err := fillUserResponse(ctx, tx, commentOwnerModel)
+
+	ngwordID, err := strconv.Atoi(c.Param("ngword_id"))
 	if err != nil {
-		return Livecomment{}, err
+		return echo.NewHTTPError(http.StatusBadRequest, "ngword_id in path must be integer")
 	}
 
-	livestreamModel := LivestreamModel{}
-	if err := tx.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livecommentModel.LivestreamID); err != nil {
-		return Livecomment{}, err
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	ngWord, err := getModeratableNGWord(ctx, tx, int64(livestreamID), int64(ngwordID), userID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Moderation().DeleteNGWord(ctx, ngWord.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete NG word: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	// 以降のライブコメント投稿から即座に反映させる
+	invalidateNGWordMatcher(ctx, ngwordMatcherKey(ngWord))
+
+	return c.NoContent(http.StatusOK)
+}
+
+// getModeratableNGWord moderateHandlerと同じく、配信者自身かモデレーターが操作できるNGワードであることを検証して返す.
+// 配信者のチャンネル全体のNGワードも配信から操作できるが、チャンネルのモデレーターに限る
+func getModeratableNGWord(ctx context.Context, tx store.Tx, livestreamID int64, ngwordID int64, userID int64) (*NGWord, error) {
+	livestreamModel, err := getModeratableLivestream(ctx, tx, livestreamID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ngWord, err := tx.Moderation().GetNGWordForUpdate(ctx, ngwordID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG word: "+err.Error())
+	}
+	if err != nil || !ngwordAppliesTo(ngWord, livestreamModel) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "NG word not found")
+	}
+	if ngWord.Scope == ngwordScopeChannel {
+		if err := authorizeChannelModeration(ctx, tx, livestreamModel.UserID, userID, permissionManageNGWords); err != nil {
+			return nil, err
+		}
+	}
+	return &ngWord, nil
+}
+
+// ngwordAppliesTo 配信から操作できるNGワードか. 全体NGワードは運営のみ操作できる
+func ngwordAppliesTo(ngWord NGWord, livestreamModel LivestreamModel) bool {
+	switch ngWord.Scope {
+	case ngwordScopeLivestream:
+		return ngWord.LivestreamID == livestreamModel.ID
+	case ngwordScopeChannel:
+		return ngWord.UserID == livestreamModel.UserID
+	}
+	return false
+}
+
+// getModeratableLivestream 配信者自身か、NGワードを管理できるモデレーターであることを検証して配信を返す
+func getModeratableLivestream(ctx context.Context, tx store.Tx, livestreamID int64, userID int64) (LivestreamModel, error) {
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, livestreamID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LivestreamModel{}, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return LivestreamModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
 	}
-	livestream, err := fillLivestreamResponse(ctx, tx, livestreamModel)
+	allowed, err := hasModerationPermission(ctx, tx, livestreamModel.UserID, livestreamModel.ID, userID, permissionManageNGWords)
+	if err != nil {
+		return LivestreamModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+	}
+	if !allowed {
+		return LivestreamModel{}, echo.NewHTTPError(http.StatusForbidden, "A streamer can't moderate livestreams that other streamers own")
+	}
+	return livestreamModel, nil
+}
+
+// limitLivecommentRate 配信のスローモードと全体のレート制限を確認する.
+// Redisに障害がある場合は投稿を止めない
+func limitLivecommentRate(c echo.Context, tx store.Tx, livestreamID int64, userID int64) error {
+	ctx := c.Request().Context()
+
+	settingsModel, err := getLivestreamSettings(ctx, tx, livestreamID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream settings: "+err.Error())
+	}
+	if settingsModel.SlowModeSeconds > 0 {
+		ok, retryAfter, err := takeSlowMode(ctx, livestreamID, userID, settingsModel.SlowModeSeconds)
+		if err != nil {
+			c.Logger().Warnf("failed to check slow mode: %v", err)
+		} else if !ok {
+			return tooManyRequests(c, retryAfter, "slow mode is enabled on this livestream")
+		}
+	}
+
+	ok, retryAfter, err := livecommentRateLimiter.take(ctx, userID)
+	if err != nil {
+		c.Logger().Warnf("failed to check livecomment rate limit: %v", err)
+	} else if !ok {
+		return tooManyRequests(c, retryAfter, "too many livecomments")
+	}
+	return nil
+}
+
+// hideLivecommentsForNGWord NGワードの適用範囲の配信について、NGワードにヒットするライブコメントを非表示にする.
+// 非表示にしたidを配信ごとに返す. 全体NGワードは過去の投稿には遡らない
+func hideLivecommentsForNGWord(ctx context.Context, tx store.Tx, ngWord *NGWord, action string, moderatorID int64) (map[int64][]int64, error) {
+	var livestreamModels []LivestreamModel
+	switch ngWord.Scope {
+	case ngwordScopeLivestream:
+		livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, ngWord.LivestreamID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			livestreamModels = append(livestreamModels, livestreamModel)
+		}
+	case ngwordScopeChannel:
+		var err error
+		livestreamModels, err = tx.Livestreams().GetLivestreamsByUserID(ctx, ngWord.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hidden := make(map[int64][]int64)
+	for _, livestreamModel := range livestreamModels {
+		logModel := &ModerationLogModel{
+			LivestreamID: livestreamModel.ID,
+			UserID:       moderatorID,
+			NGWordID:     sql.NullInt64{Int64: ngWord.ID, Valid: true},
+			Action:       action,
+			CreatedAt:    time.Now().Unix(),
+		}
+		livecommentIDs, err := hideLivecommentsByNGWords(ctx, tx, &livestreamModel, logModel)
+		if err != nil {
+			return nil, err
+		}
+		if len(livecommentIDs) > 0 {
+			hidden[livestreamModel.ID] = livecommentIDs
+		}
+	}
+	return hidden, nil
+}
+
+// hideLivecommentsByNGWords 配信に適用されるNGワードにヒットするライブコメントを非表示にし、非表示にしたidを返す.
+// ヒットしたものがあればlogModelをモデレーションログとして記録する.
+// 配信者が非表示を取り消したライブコメントと、全体NGワードにしかヒットしないライブコメントは対象にしない
+func hideLivecommentsByNGWords(ctx context.Context, tx store.Tx, livestreamModel *LivestreamModel, logModel *ModerationLogModel) ([]int64, error) {
+	ngwords, err := tx.Moderation().ListNGWords(ctx, livestreamModel.UserID, livestreamModel.ID)
+	if err != nil {
+		return nil, err
+	}
+	// 全体NGワードは過去の投稿には遡らない
+	ngwords = slices.DeleteFunc(ngwords, func(ngWord NGWord) bool { return ngWord.Scope == ngwordScopeGlobal })
+	matcher := ngword.New(toMatcherWords(ngwords))
+	if matcher.Len() == 0 {
+		return nil, nil
+	}
+
+	livecomments, err := tx.Livecomments().ListUnmoderatedLivecomments(ctx, livestreamModel.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// どのNGワードにヒットしたかも記録する
+	var hitIDs []int64
+	hitIDsByWord := make(map[int64][]int64)
+	for _, livecomment := range livecomments {
+		if hitWord, hit := matcher.Match(livecomment.Comment); hit {
+			hitIDs = append(hitIDs, livecomment.ID)
+			hitIDsByWord[hitWord.ID] = append(hitIDsByWord[hitWord.ID], livecomment.ID)
+		}
+	}
+	if len(hitIDs) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Moderation().CreateModerationLog(ctx, logModel); err != nil {
+		return nil, err
+	}
+	for ngWordID, livecommentIDs := range hitIDsByWord {
+		if err := tx.Livecomments().HideLivecomments(ctx, livecommentIDs, logModel.CreatedAt, hiddenReasonNGWord, sql.NullInt64{Int64: ngWordID, Valid: true}, logModel.ID); err != nil {
+			return nil, err
+		}
+	}
+	return hitIDs, nil
+}
+
+func publishHiddenLivecomments(ctx context.Context, hidden map[int64][]int64) {
+	for livestreamID, livecommentIDs := range hidden {
+		for _, livecommentID := range livecommentIDs {
+			if err := publishLivecommentDeleted(ctx, livestreamID, livecommentID); err != nil {
+				log.Printf("failed to publish livecomment deletion: %v", err)
+			}
+		}
+	}
+}
+
+func fillLivecommentResponse(ctx context.Context, tx store.Tx, livecommentModel LivecommentModel) (Livecomment, error) {
+	trace.StartSpan(ctx, "fillLivecommentResponse")
+	defer trace.EndSpan(ctx, nil)
+
+	livecomments, err := fillLivecommentResponses(ctx, tx, []LivecommentModel{livecommentModel})
 	if err != nil {
 		return Livecomment{}, err
 	}
+	return livecomments[0], nil
+}
 
+func newLivecommentResponse(livecommentModel LivecommentModel, commentOwner User, livestream Livestream, pinned bool) Livecomment {
 	livecomment := Livecomment{
 		ID:         livecommentModel.ID,
 		User:       commentOwner,
@@ -468,38 +935,38 @@ func fillLivecommentResponse(ctx context.Context, tx *sqlx.Tx, livecommentModel
 		Comment:    livecommentModel.Comment,
 		Tip:        livecommentModel.Tip,
 		CreatedAt:  livecommentModel.CreatedAt,
+		EditedAt:   nullInt64Ptr(livecommentModel.EditedAt),
+		Pinned:     pinned,
+		// チップ額から決まるので保存はしない
+		HighlightUntil: highlightUntil(livecommentModel),
 	}
 
-	return livecomment, nil
+	return livecomment
 }
 
-func fillLivecommentReportResponse(ctx context.Context, tx *sqlx.Tx, reportModel LivecommentReportModel) (LivecommentReport, error) {
+func fillLivecommentReportResponse(ctx context.Context, tx store.Tx, reportModel LivecommentReportModel) (LivecommentReport, error) {
 	trace.StartSpan(ctx, "fillLivecommentReportResponse")
 	defer trace.EndSpan(ctx, nil)
 
-	reporterModel := UserModel{}
-	if err := tx.GetContext(ctx, &reporterModel, "SELECT * FROM users WHERE id = ?", reportModel.UserID); err != nil {
-		return LivecommentReport{}, err
-	}
-	reporter, err := fillUserResponse(ctx, tx, reporterModel)
-	if err != nil {
-		return LivecommentReport{}, err
-	}
-
-	livecommentModel := LivecommentModel{}
-	if err := tx.GetContext(ctx, &livecommentModel, "SELECT * FROM livecomments WHERE id = ?", reportModel.LivecommentID); err != nil {
-		return LivecommentReport{}, err
-	}
-	livecomment, err := fillLivecommentResponse(ctx, tx, livecommentModel)
+	reports, err := fillLivecommentReportResponses(ctx, tx, []LivecommentReportModel{reportModel})
 	if err != nil {
 		return LivecommentReport{}, err
 	}
+	return reports[0], nil
+}
 
+func newLivecommentReportResponse(reportModel LivecommentReportModel, reporter User, livecommentModel LivecommentModel, livecomment Livecomment) LivecommentReport {
 	report := LivecommentReport{
 		ID:          reportModel.ID,
 		Reporter:    reporter,
 		Livecomment: livecomment,
 		CreatedAt:   reportModel.CreatedAt,
+		Status:      reportModel.Status,
+		ResolvedAt:  nullInt64Ptr(reportModel.ResolvedAt),
+		AutoHidden:  livecommentModel.HiddenAt.Valid && livecommentModel.HiddenReason.String == hiddenReasonReportThreshold,
+	}
+	if reportModel.Action.Valid {
+		report.Action = &reportModel.Action.String
 	}
-	return report, nil
+	return report
 }
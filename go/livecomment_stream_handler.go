@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo/v4"
+)
+
+const sseHeartbeatInterval = 15 * time.Second
+
+// ライブコメントのSSE配信
+// GET /api/livestream/:livestream_id/livecomment/stream
+func streamLivecommentsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "streamLivecommentsHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// EventSourceは初回接続時にヘッダを付けられないので、クエリでも受け付ける
+	lastEventIDParam := c.Request().Header.Get("Last-Event-ID")
+	if lastEventIDParam == "" {
+		lastEventIDParam = c.QueryParam("last_event_id")
+	}
+	var lastEventID int64
+	if lastEventIDParam != "" {
+		lastEventID, err = strconv.ParseInt(lastEventIDParam, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Last-Event-ID must be integer")
+		}
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, int64(livestreamID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+		}
+	}
+
+	// 取りこぼし分を取得する前に購読を開始しておくことで、再接続時の欠落を防ぐ
+	sub := eventHub.subscribe(livestreamModel.ID)
+	defer eventHub.unsubscribe(sub)
+
+	var backlog []Livecomment
+	if lastEventID > 0 {
+		livecommentModels, err := tx.Livecomments().ListVisibleLivecommentsAfter(ctx, livestreamModel.ID, lastEventID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
+		}
+		backlog, err = fillLivecommentResponses(ctx, tx, livecommentModels)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment: "+err.Error())
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// nginxのバッファリングを無効化
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	// 購読開始からbacklog取得までの間に届いたイベントとの重複を除く
+	sent := make(map[int64]struct{}, len(backlog))
+	for _, livecomment := range backlog {
+		data, err := json.Marshal(livecomment)
+		if err != nil {
+			c.Logger().Errorf("failed to marshal livecomment: %v", err)
+			return nil
+		}
+		if err := writeServerSentEvent(res, livestreamEvent{Type: eventLivecomment, ID: livecomment.ID, Data: data}); err != nil {
+			return nil
+		}
+		sent[livecomment.ID] = struct{}{}
+	}
+	res.Flush()
+
+	ticker := time.NewTicker(sseHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.dropped:
+			// 送信が追いつかなかったので切断する. クライアントはLast-Event-IDで再開できる
+			return nil
+		case ev := <-sub.events:
+			switch ev.Type {
+			case eventLivecomment:
+				if _, ok := sent[ev.ID]; ok {
+					continue
+				}
+			case eventLivecommentDeleted, eventLivecommentEdited, eventLivecommentPinned:
+			default:
+				// リアクション等はWebSocketでのみ配信する
+				continue
+			}
+			if err := writeServerSentEvent(res, ev); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-ticker.C:
+			if _, err := io.WriteString(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+func writeServerSentEvent(w io.Writer, ev livestreamEvent) error {
+	if ev.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", ev.ID); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+	return err
+}
@@ -11,8 +11,8 @@ import (
 
 	"github.com/goccy/go-json"
 
+	"github.com/isucon/isucon13/webapp/go/store"
 	"github.com/isucon/isucon13/webapp/go/trace"
-	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
@@ -25,24 +25,25 @@ type ReserveLivestreamRequest struct {
 	ThumbnailUrl string  `json:"thumbnail_url"`
 	StartAt      int64   `json:"start_at"`
 	EndAt        int64   `json:"end_at"`
+	// Recurrence 指定した場合は繰り返し予約としてまとめて予約する
+	Recurrence *Recurrence `json:"recurrence"`
 }
 
-type LivestreamViewerModel struct {
-	UserID       int64 `db:"user_id" json:"user_id"`
-	LivestreamID int64 `db:"livestream_id" json:"livestream_id"`
-	CreatedAt    int64 `db:"created_at" json:"created_at"`
+// PatchLivestreamRequest 指定したフィールドのみ変更する
+type PatchLivestreamRequest struct {
+	// Tags 指定した場合は全て置き換える
+	Tags         *[]int64 `json:"tags"`
+	Title        *string  `json:"title"`
+	Description  *string  `json:"description"`
+	PlaylistUrl  *string  `json:"playlist_url"`
+	ThumbnailUrl *string  `json:"thumbnail_url"`
+	StartAt      *int64   `json:"start_at"`
+	EndAt        *int64   `json:"end_at"`
 }
 
-type LivestreamModel struct {
-	ID           int64  `db:"id" json:"id"`
-	UserID       int64  `db:"user_id" json:"user_id"`
-	Title        string `db:"title" json:"title"`
-	Description  string `db:"description" json:"description"`
-	PlaylistUrl  string `db:"playlist_url" json:"playlist_url"`
-	ThumbnailUrl string `db:"thumbnail_url" json:"thumbnail_url"`
-	StartAt      int64  `db:"start_at" json:"start_at"`
-	EndAt        int64  `db:"end_at" json:"end_at"`
-}
+type LivestreamViewerModel = store.LivestreamViewer
+
+type LivestreamModel = store.Livestream
 
 type Livestream struct {
 	ID           int64  `json:"id"`
@@ -54,20 +55,13 @@ type Livestream struct {
 	Tags         []Tag  `json:"tags"`
 	StartAt      int64  `json:"start_at"`
 	EndAt        int64  `json:"end_at"`
+	// SeriesID 繰り返し予約で作成した場合のみ
+	SeriesID int64 `json:"series_id,omitempty"`
 }
 
-type LivestreamTagModel struct {
-	ID           int64 `db:"id" json:"id"`
-	LivestreamID int64 `db:"livestream_id" json:"livestream_id"`
-	TagID        int64 `db:"tag_id" json:"tag_id"`
-}
+type LivestreamTagModel = store.LivestreamTag
 
-type ReservationSlotModel struct {
-	ID      int64 `db:"id" json:"id"`
-	Slot    int64 `db:"slot" json:"slot"`
-	StartAt int64 `db:"start_at" json:"start_at"`
-	EndAt   int64 `db:"end_at" json:"end_at"`
-}
+type ReservationSlotModel = store.ReservationSlot
 
 func reserveLivestreamHandler(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -93,87 +87,85 @@ func reserveLivestreamHandler(c echo.Context) error {
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
+	if req.Recurrence != nil {
+		return reserveLivestreamSeries(c, userID, req)
+	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	// 2023/11/25 10:00からの１年間の期間内であるかチェック
+	livestreamModel := &LivestreamModel{
+		UserID:       int64(userID),
+		Title:        req.Title,
+		Description:  req.Description,
+		PlaylistUrl:  req.PlaylistUrl,
+		ThumbnailUrl: req.ThumbnailUrl,
+		StartAt:      req.StartAt,
+		EndAt:        req.EndAt,
+	}
+	if err := reserveLivestream(ctx, c, tx, livestreamModel, req.Tags); err != nil {
+		return err
+	}
+
+	livestream, err := fillLivestreamResponse(ctx, tx, *livestreamModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, livestream)
+}
+
+// reserveLivestream 予約枠を確保して配信とタグを作成する.
+// 予約できない場合は、何も書き込まずに400のecho.HTTPErrorを返す
+func reserveLivestream(ctx context.Context, c echo.Context, tx store.Tx, livestreamModel *LivestreamModel, tags []int64) error {
+	// 予約可能な期間内であるかチェック
 	var (
-		termStartAt    = time.Date(2023, 11, 25, 1, 0, 0, 0, time.UTC)
-		termEndAt      = time.Date(2024, 11, 25, 1, 0, 0, 0, time.UTC)
-		reserveStartAt = time.Unix(req.StartAt, 0)
-		reserveEndAt   = time.Unix(req.EndAt, 0)
+		termStartAt = reservationTermStartAt
+		termEndAt   = reservationTermEndAt
 	)
-	if (reserveStartAt.Equal(termEndAt) || reserveStartAt.After(termEndAt)) || (reserveEndAt.Equal(termStartAt) || reserveEndAt.Before(termStartAt)) {
+	if !inReservationTerm(livestreamModel.StartAt, livestreamModel.EndAt) {
 		return echo.NewHTTPError(http.StatusBadRequest, "bad reservation time range")
 	}
 
 	// 予約枠をみて、予約が可能か調べる
 	// NOTE: 並列な予約のoverbooking防止にFOR UPDATEが必要
-	var slots []*ReservationSlotModel
-	if err := tx.SelectContext(ctx, &slots, "SELECT * FROM reservation_slots WHERE start_at >= ? AND end_at <= ? FOR UPDATE", req.StartAt, req.EndAt); err != nil {
+	slots, err := tx.Reservations().GetSlotsForUpdate(ctx, livestreamModel.StartAt, livestreamModel.EndAt)
+	if err != nil {
 		c.Logger().Warnf("予約枠一覧取得でエラー発生: %+v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
 	}
 	for _, slot := range slots {
-		var count int
-		if err := tx.GetContext(ctx, &count, "SELECT slot FROM reservation_slots WHERE start_at = ? AND end_at = ?", slot.StartAt, slot.EndAt); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
-		}
 		c.Logger().Infof("%d ~ %d予約枠の残数 = %d\n", slot.StartAt, slot.EndAt, slot.Slot)
-		if count < 1 {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("予約期間 %d ~ %dに対して、予約区間 %d ~ %dが予約できません", termStartAt.Unix(), termEndAt.Unix(), req.StartAt, req.EndAt))
+		if slot.Slot < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("予約期間 %d ~ %dに対して、予約区間 %d ~ %dが予約できません", termStartAt.Unix(), termEndAt.Unix(), livestreamModel.StartAt, livestreamModel.EndAt))
 		}
 	}
 
-	livestreamModel := &LivestreamModel{
-		UserID:       int64(userID),
-		Title:        req.Title,
-		Description:  req.Description,
-		PlaylistUrl:  req.PlaylistUrl,
-		ThumbnailUrl: req.ThumbnailUrl,
-		StartAt:      req.StartAt,
-		EndAt:        req.EndAt,
-	}
-
-	if _, err := tx.ExecContext(ctx, "UPDATE reservation_slots SET slot = slot - 1 WHERE start_at >= ? AND end_at <= ?", req.StartAt, req.EndAt); err != nil {
+	if err := tx.Reservations().DecrementSlots(ctx, livestreamModel.StartAt, livestreamModel.EndAt); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update reservation_slot: "+err.Error())
 	}
 
-	rs, err := tx.NamedExecContext(ctx, "INSERT INTO livestreams (user_id, title, description, playlist_url, thumbnail_url, start_at, end_at) VALUES(:user_id, :title, :description, :playlist_url, :thumbnail_url, :start_at, :end_at)", livestreamModel)
-	if err != nil {
+	if err := tx.Livestreams().CreateLivestream(ctx, livestreamModel); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream: "+err.Error())
 	}
 
-	livestreamID, err := rs.LastInsertId()
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted livestream id: "+err.Error())
-	}
-	livestreamModel.ID = livestreamID
-
 	// タグ追加
-	for _, tagID := range req.Tags {
-		if _, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_tags (livestream_id, tag_id) VALUES (:livestream_id, :tag_id)", &LivestreamTagModel{
-			LivestreamID: livestreamID,
+	for _, tagID := range tags {
+		if err := tx.Livestreams().CreateLivestreamTag(ctx, &LivestreamTagModel{
+			LivestreamID: livestreamModel.ID,
 			TagID:        tagID,
 		}); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream tag: "+err.Error())
 		}
 	}
-
-	livestream, err := fillLivestreamResponse(ctx, tx, *livestreamModel)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
-	}
-
-	if err := tx.Commit(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
-	}
-
-	return c.JSON(http.StatusCreated, livestream)
+	return nil
 }
 
 func searchLivestreamsHandler(c echo.Context) error {
@@ -183,60 +175,52 @@ func searchLivestreamsHandler(c echo.Context) error {
 
 	keyTagName := c.QueryParam("tag")
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	var livestreamModels []*LivestreamModel
+	var livestreamModels []LivestreamModel
 	if c.QueryParam("tag") != "" {
 		// タグによる取得
-		var tagIDList []int
-		if err := tx.SelectContext(ctx, &tagIDList, "SELECT id FROM tags WHERE name = ?", keyTagName); err != nil {
+		tagIDList, err := tx.Livestreams().GetTagIDsByName(ctx, keyTagName)
+		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get tags: "+err.Error())
 		}
 
-		query, params, err := sqlx.In("SELECT * FROM livestream_tags WHERE tag_id IN (?) ORDER BY livestream_id DESC", tagIDList)
+		keyTaggedLivestreams, err := tx.Livestreams().GetLivestreamTagsByTagIDs(ctx, tagIDList)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
-		}
-		var keyTaggedLivestreams []*LivestreamTagModel
-		if err := tx.SelectContext(ctx, &keyTaggedLivestreams, query, params...); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get keyTaggedLivestreams: "+err.Error())
 		}
 
-		for _, keyTaggedLivestream := range keyTaggedLivestreams {
-			ls := LivestreamModel{}
-			if err := tx.GetContext(ctx, &ls, "SELECT * FROM livestreams WHERE id = ?", keyTaggedLivestream.LivestreamID); err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
-			}
-
-			livestreamModels = append(livestreamModels, &ls)
+		livestreamIDs := make([]int64, len(keyTaggedLivestreams))
+		for i := range keyTaggedLivestreams {
+			livestreamIDs[i] = keyTaggedLivestreams[i].LivestreamID
+		}
+		livestreamModels, err = tx.Livestreams().GetLivestreamsByIDs(ctx, livestreamIDs)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
 		}
 	} else {
 		// 検索条件なし
-		query := `SELECT * FROM livestreams ORDER BY id DESC`
+		var limit int
 		if c.QueryParam("limit") != "" {
-			limit, err := strconv.Atoi(c.QueryParam("limit"))
+			limit, err = strconv.Atoi(c.QueryParam("limit"))
 			if err != nil {
 				return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer")
 			}
-			query += fmt.Sprintf(" LIMIT %d", limit)
 		}
 
-		if err := tx.SelectContext(ctx, &livestreamModels, query); err != nil {
+		livestreamModels, err = tx.Livestreams().ListLivestreams(ctx, limit)
+		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
 		}
 	}
 
-	livestreams := make([]Livestream, len(livestreamModels))
-	for i := range livestreamModels {
-		livestream, err := fillLivestreamResponse(ctx, tx, *livestreamModels[i])
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
-		}
-		livestreams[i] = livestream
+	livestreams, err := fillLivestreamResponses(ctx, tx, livestreamModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -255,7 +239,7 @@ func getMyLivestreamsHandler(c echo.Context) error {
 		return err
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
@@ -266,17 +250,13 @@ func getMyLivestreamsHandler(c echo.Context) error {
 	// existence already checked
 	userID := sess.Values[defaultUserIDKey].(int64)
 
-	var livestreamModels []*LivestreamModel
-	if err := tx.SelectContext(ctx, &livestreamModels, "SELECT * FROM livestreams WHERE user_id = ?", userID); err != nil {
+	livestreamModels, err := tx.Livestreams().GetLivestreamsByUserID(ctx, userID)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
 	}
-	livestreams := make([]Livestream, len(livestreamModels))
-	for i := range livestreamModels {
-		livestream, err := fillLivestreamResponse(ctx, tx, *livestreamModels[i])
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
-		}
-		livestreams[i] = livestream
+	livestreams, err := fillLivestreamResponses(ctx, tx, livestreamModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -297,14 +277,14 @@ func getUserLivestreamsHandler(c echo.Context) error {
 
 	username := c.Param("username")
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	var user UserModel
-	if err := tx.GetContext(ctx, &user, "SELECT id FROM users WHERE name = ?", username); err != nil {
+	user, err := tx.Users().GetUserByName(ctx, username)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return echo.NewHTTPError(http.StatusNotFound, "user not found")
 		} else {
@@ -312,17 +292,13 @@ func getUserLivestreamsHandler(c echo.Context) error {
 		}
 	}
 
-	var livestreamModels []*LivestreamModel
-	if err := tx.SelectContext(ctx, &livestreamModels, "SELECT * FROM livestreams WHERE user_id = ?", user.ID); err != nil {
+	livestreamModels, err := tx.Livestreams().GetLivestreamsByUserID(ctx, user.ID)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
 	}
-	livestreams := make([]Livestream, len(livestreamModels))
-	for i := range livestreamModels {
-		livestream, err := fillLivestreamResponse(ctx, tx, *livestreamModels[i])
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
-		}
-		livestreams[i] = livestream
+	livestreams, err := fillLivestreamResponses(ctx, tx, livestreamModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -353,26 +329,39 @@ func enterLivestreamHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id must be integer")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
+	if err := verifyNotBanned(ctx, tx, userID, int64(livestreamID)); err != nil {
+		return err
+	}
+
 	viewer := LivestreamViewerModel{
 		UserID:       int64(userID),
 		LivestreamID: int64(livestreamID),
 		CreatedAt:    time.Now().Unix(),
 	}
 
-	if _, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_viewers_history (user_id, livestream_id, created_at) VALUES(:user_id, :livestream_id, :created_at)", viewer); err != nil {
+	if err := tx.Livestreams().CreateViewer(ctx, &viewer); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream_view_history: "+err.Error())
 	}
 
+	viewersCount, err := tx.Livestreams().CountViewers(ctx, int64(livestreamID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count livestream viewers: "+err.Error())
+	}
+
 	if err := tx.Commit(); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
+	if err := publishViewersCount(ctx, int64(livestreamID), viewersCount); err != nil {
+		c.Logger().Warnf("failed to publish viewers count: %v", err)
+	}
+
 	return c.NoContent(http.StatusOK)
 }
 
@@ -396,20 +385,29 @@ func exitLivestreamHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.ExecContext(ctx, "DELETE FROM livestream_viewers_history WHERE user_id = ? AND livestream_id = ?", userID, livestreamID); err != nil {
+	if err := tx.Livestreams().DeleteViewer(ctx, userID, int64(livestreamID)); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream_view_history: "+err.Error())
 	}
 
+	viewersCount, err := tx.Livestreams().CountViewers(ctx, int64(livestreamID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count livestream viewers: "+err.Error())
+	}
+
 	if err := tx.Commit(); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
+	if err := publishViewersCount(ctx, int64(livestreamID), viewersCount); err != nil {
+		c.Logger().Warnf("failed to publish viewers count: %v", err)
+	}
+
 	return c.NoContent(http.StatusOK)
 }
 
@@ -427,20 +425,153 @@ func getLivestreamHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, int64(livestreamID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "not found livestream that has the given id")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+
+	livestream, err := fillLivestreamResponse(ctx, tx, livestreamModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, livestream)
+}
+
+// 配信予約の変更API
+// PATCH /api/livestream/:livestream_id
+func patchLivestreamHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "patchLivestreamHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	var req PatchLivestreamRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	livestreamModel := LivestreamModel{}
-	err = tx.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID)
+	// 取り消しと競合して古い予約区間の予約枠を戻さないよう、予約枠より先に配信をロックする
+	livestreamModel, err := tx.Livestreams().GetLivestreamByIDForUpdate(ctx, int64(livestreamID))
 	if errors.Is(err, sql.ErrNoRows) {
 		return echo.NewHTTPError(http.StatusNotFound, "not found livestream that has the given id")
 	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
 	}
+	if livestreamModel.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "can't edit other streamer's livestream")
+	}
+
+	newStartAt, newEndAt := livestreamModel.StartAt, livestreamModel.EndAt
+	if req.StartAt != nil {
+		newStartAt = *req.StartAt
+	}
+	if req.EndAt != nil {
+		newEndAt = *req.EndAt
+	}
+	if newStartAt != livestreamModel.StartAt || newEndAt != livestreamModel.EndAt {
+		now := time.Now().Unix()
+		if now >= livestreamModel.StartAt {
+			return echo.NewHTTPError(http.StatusBadRequest, "can't reschedule the livestream that has already started")
+		}
+		if newStartAt <= now {
+			return echo.NewHTTPError(http.StatusBadRequest, "start_at must be in the future")
+		}
+		if newStartAt >= newEndAt {
+			return echo.NewHTTPError(http.StatusBadRequest, "start_at must be before end_at")
+		}
+		if !inReservationTerm(newStartAt, newEndAt) {
+			return echo.NewHTTPError(http.StatusBadRequest, "bad reservation time range")
+		}
+
+		// 変更前後の区間をまとめてロックし、予約や取り消しとロックの順序を揃える
+		if _, err := tx.Reservations().GetSlotsForUpdate(ctx, min(livestreamModel.StartAt, newStartAt), max(livestreamModel.EndAt, newEndAt)); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
+		}
+		// 区間が重なっている場合に自身の予約で埋まっていると判定しないよう、先に変更前の区間を戻す
+		if err := tx.Reservations().IncrementSlots(ctx, livestreamModel.StartAt, livestreamModel.EndAt); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update reservation_slot: "+err.Error())
+		}
+		slots, err := tx.Reservations().GetSlotsForUpdate(ctx, newStartAt, newEndAt)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
+		}
+		for _, slot := range slots {
+			if slot.Slot < 1 {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("予約枠 %d ~ %dに空きがないため、予約区間 %d ~ %dに変更できません", slot.StartAt, slot.EndAt, newStartAt, newEndAt))
+			}
+		}
+		if err := tx.Reservations().DecrementSlots(ctx, newStartAt, newEndAt); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update reservation_slot: "+err.Error())
+		}
+		livestreamModel.StartAt, livestreamModel.EndAt = newStartAt, newEndAt
+	}
+
+	if req.Title != nil {
+		livestreamModel.Title = *req.Title
+	}
+	if req.Description != nil {
+		livestreamModel.Description = *req.Description
+	}
+	if req.PlaylistUrl != nil {
+		livestreamModel.PlaylistUrl = *req.PlaylistUrl
+	}
+	if req.ThumbnailUrl != nil {
+		livestreamModel.ThumbnailUrl = *req.ThumbnailUrl
+	}
+	if err := tx.Livestreams().UpdateLivestream(ctx, &livestreamModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update livestream: "+err.Error())
+	}
+
+	if req.Tags != nil {
+		if err := tx.Livestreams().DeleteLivestreamTags(ctx, livestreamModel.ID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream tags: "+err.Error())
+		}
+		for _, tagID := range *req.Tags {
+			if err := tx.Livestreams().CreateLivestreamTag(ctx, &LivestreamTagModel{
+				LivestreamID: livestreamModel.ID,
+				TagID:        tagID,
+			}); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream tag: "+err.Error())
+			}
+		}
+	}
 
 	livestream, err := fillLivestreamResponse(ctx, tx, livestreamModel)
 	if err != nil {
@@ -454,6 +585,121 @@ func getLivestreamHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, livestream)
 }
 
+// 配信予約の取り消しAPI
+// DELETE /api/livestream/:livestream_id
+func cancelLivestreamHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "cancelLivestreamHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livestreamModel, err := tx.Livestreams().GetLivestreamByIDForUpdate(ctx, int64(livestreamID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "not found livestream that has the given id")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+	if livestreamModel.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "can't cancel other streamer's livestream")
+	}
+	if time.Now().Unix() >= livestreamModel.StartAt {
+		return echo.NewHTTPError(http.StatusBadRequest, "can't cancel the livestream that has already started")
+	}
+
+	deleted, err := cancelLivestream(ctx, tx, livestreamModel)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "not found livestream that has the given id")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+	invalidateNGWordMatcher(ctx, livestreamNGWordKey(livestreamModel.ID))
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// cancelLivestream 配信と配信に紐づくデータを削除して予約枠を戻す. 既に削除されていた場合はfalseを返す.
+// 配信者やユーザ全体に紐づくモデレーター、BAN、NGワードは残す.
+// 変更と競合しないよう、livestreamModelはGetLivestreamByIDForUpdateで読んだものを渡すこと.
+// NGワードのキャッシュの破棄はコミット後に呼び出し側で行う
+func cancelLivestream(ctx context.Context, tx store.Tx, livestreamModel LivestreamModel) (bool, error) {
+	// 予約と同じ順序で予約枠をロックしてから、残数を戻す
+	if _, err := tx.Reservations().GetSlotsForUpdate(ctx, livestreamModel.StartAt, livestreamModel.EndAt); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
+	}
+	// 同時に取り消された場合は、先に削除した方だけが予約枠を戻す
+	deleted, err := tx.Livestreams().DeleteLivestream(ctx, livestreamModel.ID)
+	if err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream: "+err.Error())
+	}
+	if !deleted {
+		return false, nil
+	}
+	if err := tx.Reservations().IncrementSlots(ctx, livestreamModel.StartAt, livestreamModel.EndAt); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to update reservation_slot: "+err.Error())
+	}
+
+	if err := tx.Livestreams().DeleteLivestreamTags(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream tags: "+err.Error())
+	}
+	if err := tx.Livestreams().DeleteViewers(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream viewers: "+err.Error())
+	}
+	if err := tx.Livecomments().DeletePin(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream pin: "+err.Error())
+	}
+	if err := tx.Livecomments().DeleteReports(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livecomment reports: "+err.Error())
+	}
+	if err := tx.Livecomments().DeleteLivecomments(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livecomments: "+err.Error())
+	}
+	if err := tx.Reactions().DeleteReactions(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete reactions: "+err.Error())
+	}
+	if err := tx.Moderation().DeleteLivestreamNGWords(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete NG words: "+err.Error())
+	}
+	if err := tx.Moderation().DeleteModerationLogs(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete moderation logs: "+err.Error())
+	}
+	if err := tx.Moderation().DeleteLivestreamModerators(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete moderators: "+err.Error())
+	}
+	if err := tx.Moderation().DeleteLivestreamBans(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete user bans: "+err.Error())
+	}
+	if err := tx.Moderation().DeleteLivestreamSettings(ctx, livestreamModel.ID); err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream settings: "+err.Error())
+	}
+	return true, nil
+}
+
 func getLivecommentReportsHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	trace.StartSpan(ctx, "getLivecommentReportsHandler")
@@ -468,14 +714,14 @@ func getLivecommentReportsHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	var livestreamModel LivestreamModel
-	if err := tx.GetContext(ctx, &livestreamModel, "SELECT user_id FROM livestreams WHERE id = ?", livestreamID); err != nil {
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, int64(livestreamID))
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
 	}
 
@@ -484,22 +730,30 @@ func getLivecommentReportsHandler(c echo.Context) error {
 	// existence already check
 	userID := sess.Values[defaultUserIDKey].(int64)
 
-	if livestreamModel.UserID != userID {
+	allowed, err := hasModerationPermission(ctx, tx, livestreamModel.UserID, int64(livestreamID), userID, permissionViewReports)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+	}
+	if !allowed {
 		return echo.NewHTTPError(http.StatusForbidden, "can't get other streamer's livecomment reports")
 	}
 
-	var reportModels []*LivecommentReportModel
-	if err := tx.SelectContext(ctx, &reportModels, "SELECT * FROM livecomment_reports WHERE livestream_id = ?", livestreamID); err != nil {
+	// statusを指定した場合はその状態の報告のみ返す
+	status := c.QueryParam("status")
+	switch status {
+	case "", reportStatusOpen, reportStatusDismissed, reportStatusActioned:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "status must be open, dismissed or actioned")
+	}
+
+	reportModels, err := tx.Livecomments().ListReports(ctx, int64(livestreamID), status)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment reports: "+err.Error())
 	}
 
-	reports := make([]LivecommentReport, len(reportModels))
-	for i := range reportModels {
-		report, err := fillLivecommentReportResponse(ctx, tx, *reportModels[i])
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment report: "+err.Error())
-		}
-		reports[i] = report
+	reports, err := fillLivecommentReportResponses(ctx, tx, reportModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment report: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -509,37 +763,18 @@ func getLivecommentReportsHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, reports)
 }
 
-func fillLivestreamResponse(ctx context.Context, tx *sqlx.Tx, livestreamModel LivestreamModel) (Livestream, error) {
+func fillLivestreamResponse(ctx context.Context, tx store.Tx, livestreamModel LivestreamModel) (Livestream, error) {
 	trace.StartSpan(ctx, "fillLivestreamResponse")
 	defer trace.EndSpan(ctx, nil)
 
-	ownerModel := UserModel{}
-	if err := tx.GetContext(ctx, &ownerModel, "SELECT * FROM users WHERE id = ?", livestreamModel.UserID); err != nil {
-		return Livestream{}, err
-	}
-	owner, err := fillUserResponse(ctx, tx, ownerModel)
+	livestreams, err := fillLivestreamResponses(ctx, tx, []LivestreamModel{livestreamModel})
 	if err != nil {
 		return Livestream{}, err
 	}
+	return livestreams[0], nil
+}
 
-	var livestreamTagModels []*LivestreamTagModel
-	if err := tx.SelectContext(ctx, &livestreamTagModels, "SELECT * FROM livestream_tags WHERE livestream_id = ?", livestreamModel.ID); err != nil {
-		return Livestream{}, err
-	}
-
-	tags := make([]Tag, len(livestreamTagModels))
-	for i := range livestreamTagModels {
-		tagModel := TagModel{}
-		if err := tx.GetContext(ctx, &tagModel, "SELECT * FROM tags WHERE id = ?", livestreamTagModels[i].TagID); err != nil {
-			return Livestream{}, err
-		}
-
-		tags[i] = Tag{
-			ID:   tagModel.ID,
-			Name: tagModel.Name,
-		}
-	}
-
+func newLivestreamResponse(livestreamModel LivestreamModel, owner User, tags []Tag) Livestream {
 	livestream := Livestream{
 		ID:           livestreamModel.ID,
 		Owner:        owner,
@@ -550,6 +785,7 @@ func fillLivestreamResponse(ctx context.Context, tx *sqlx.Tx, livestreamModel Li
 		ThumbnailUrl: livestreamModel.ThumbnailUrl,
 		StartAt:      livestreamModel.StartAt,
 		EndAt:        livestreamModel.EndAt,
+		SeriesID:     livestreamModel.SeriesID.Int64,
 	}
-	return livestream, nil
+	return livestream
 }
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/isucon/isucon13/webapp/go/store"
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	recurrenceDaily  = "daily"
+	recurrenceWeekly = "weekly"
+
+	// recurrenceModeAllOrNothing 1回でも予約できなければ全て予約しない
+	recurrenceModeAllOrNothing = "all_or_nothing"
+	// recurrenceModeBestEffort 予約できた回だけ予約する
+	recurrenceModeBestEffort = "best_effort"
+
+	// maxRecurrenceInstances 1回の繰り返し予約で作成できる配信の数
+	maxRecurrenceInstances = 52
+)
+
+type LivestreamSeriesModel = store.LivestreamSeries
+
+// Recurrence 繰り返し予約のルール. CountとUntilはどちらか一方を指定する
+type Recurrence struct {
+	// Frequency daily, weekly
+	Frequency string `json:"frequency"`
+	Count     int    `json:"count"`
+	// Until この時刻までに開始する回を予約する
+	Until int64 `json:"until"`
+	// Mode all_or_nothing (省略時), best_effort
+	Mode string `json:"mode"`
+}
+
+type ReservationInstanceResult struct {
+	StartAt  int64 `json:"start_at"`
+	EndAt    int64 `json:"end_at"`
+	Reserved bool  `json:"reserved"`
+	// Livestream 予約できた場合のみ
+	Livestream *Livestream `json:"livestream,omitempty"`
+	// Error 予約できなかった理由
+	Error string `json:"error,omitempty"`
+}
+
+type ReserveLivestreamSeriesResponse struct {
+	// SeriesID 1回も予約されなかった場合は0
+	SeriesID  int64                       `json:"series_id"`
+	Instances []ReservationInstanceResult `json:"instances"`
+}
+
+type CancelLivestreamSeriesResponse struct {
+	CancelledLivestreamIDs []int64 `json:"cancelled_livestream_ids"`
+}
+
+// recurrenceStartAts 繰り返し予約の各回の開始時刻を返す
+func recurrenceStartAts(startAt, endAt int64, recurrence Recurrence) ([]int64, error) {
+	var interval int64
+	switch recurrence.Frequency {
+	case recurrenceDaily:
+		interval = 24 * 60 * 60
+	case recurrenceWeekly:
+		interval = 7 * 24 * 60 * 60
+	default:
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "recurrence frequency must be daily or weekly")
+	}
+	if startAt >= endAt {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "start_at must be before end_at")
+	}
+	// 各回が重なると、同じ予約枠を1つの配信者が複数確保することになる
+	if endAt-startAt > interval {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "livestream must not be longer than the recurrence interval")
+	}
+	if (recurrence.Count > 0) == (recurrence.Until > 0) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "either recurrence count or until must be specified")
+	}
+
+	var startAts []int64
+	if recurrence.Count > 0 {
+		if recurrence.Count > maxRecurrenceInstances {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("recurrence count must be at most %d", maxRecurrenceInstances))
+		}
+		for i := 0; i < recurrence.Count; i++ {
+			startAts = append(startAts, startAt+int64(i)*interval)
+		}
+		return startAts, nil
+	}
+	if recurrence.Until < startAt {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "recurrence until must not be before start_at")
+	}
+	for t := startAt; t <= recurrence.Until; t += interval {
+		if len(startAts) == maxRecurrenceInstances {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("recurrence must not have more than %d instances", maxRecurrenceInstances))
+		}
+		startAts = append(startAts, t)
+	}
+	return startAts, nil
+}
+
+// reserveLivestreamSeries 繰り返し予約の全ての回を1つのトランザクションで予約する
+func reserveLivestreamSeries(c echo.Context, userID int64, req *ReserveLivestreamRequest) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "reserveLivestreamSeries")
+	defer trace.EndSpan(ctx, nil)
+
+	recurrence := *req.Recurrence
+	if recurrence.Mode == "" {
+		recurrence.Mode = recurrenceModeAllOrNothing
+	}
+	if recurrence.Mode != recurrenceModeAllOrNothing && recurrence.Mode != recurrenceModeBestEffort {
+		return echo.NewHTTPError(http.StatusBadRequest, "recurrence mode must be all_or_nothing or best_effort")
+	}
+	startAts, err := recurrenceStartAts(req.StartAt, req.EndAt, recurrence)
+	if err != nil {
+		return err
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	series := &LivestreamSeriesModel{
+		UserID:    userID,
+		Frequency: recurrence.Frequency,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := tx.Livestreams().CreateSeries(ctx, series); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream series: "+err.Error())
+	}
+
+	// 予約枠のロックの順序を揃えるため、開始時刻の順に予約する
+	duration := req.EndAt - req.StartAt
+	results := make([]ReservationInstanceResult, len(startAts))
+	var (
+		reservedIndexes  []int
+		livestreamModels []LivestreamModel
+	)
+	for i, startAt := range startAts {
+		results[i] = ReservationInstanceResult{StartAt: startAt, EndAt: startAt + duration}
+		livestreamModel := &LivestreamModel{
+			UserID:       userID,
+			Title:        req.Title,
+			Description:  req.Description,
+			PlaylistUrl:  req.PlaylistUrl,
+			ThumbnailUrl: req.ThumbnailUrl,
+			StartAt:      startAt,
+			EndAt:        startAt + duration,
+			SeriesID:     sql.NullInt64{Int64: series.ID, Valid: true},
+		}
+		if err := reserveLivestream(ctx, c, tx, livestreamModel, req.Tags); err != nil {
+			var he *echo.HTTPError
+			if !errors.As(err, &he) || he.Code != http.StatusBadRequest {
+				return err
+			}
+			// 予約できなかった回は何も書き込まれていないので、残りの回の予約を続ける
+			results[i].Error = fmt.Sprint(he.Message)
+			continue
+		}
+		reservedIndexes = append(reservedIndexes, i)
+		livestreamModels = append(livestreamModels, *livestreamModel)
+	}
+
+	failed := len(startAts) - len(reservedIndexes)
+	if len(reservedIndexes) == 0 || (failed > 0 && recurrence.Mode == recurrenceModeAllOrNothing) {
+		for _, i := range reservedIndexes {
+			results[i].Error = "not reserved because other instances could not be reserved"
+		}
+		return c.JSON(http.StatusBadRequest, ReserveLivestreamSeriesResponse{Instances: results})
+	}
+
+	livestreams, err := fillLivestreamResponses(ctx, tx, livestreamModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
+	}
+	for j, i := range reservedIndexes {
+		results[i].Reserved = true
+		results[i].Livestream = &livestreams[j]
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, ReserveLivestreamSeriesResponse{
+		SeriesID:  series.ID,
+		Instances: results,
+	})
+}
+
+// 繰り返し予約のうち、開始前の回をまとめて取り消すAPI
+// DELETE /api/livestream/series/:series_id
+func cancelLivestreamSeriesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "cancelLivestreamSeriesHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	seriesID, err := strconv.Atoi(c.Param("series_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "series_id in path must be integer")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	series, err := tx.Livestreams().GetSeriesByID(ctx, int64(seriesID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "not found livestream series that has the given id")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream series: "+err.Error())
+	}
+	if series.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "can't cancel other streamer's livestream series")
+	}
+
+	livestreamModels, err := tx.Livestreams().GetLivestreamsBySeriesID(ctx, series.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
+	}
+
+	// 開始済みの回は残す
+	now := time.Now().Unix()
+	cancelledIDs := []int64{}
+	for _, livestreamModel := range livestreamModels {
+		// 予約区間を変更中の回があれば、その完了を待ってから変更後の区間を読む
+		livestreamModel, err := tx.Livestreams().GetLivestreamByIDForUpdate(ctx, livestreamModel.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+		}
+		if now >= livestreamModel.StartAt {
+			continue
+		}
+		deleted, err := cancelLivestream(ctx, tx, livestreamModel)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			cancelledIDs = append(cancelledIDs, livestreamModel.ID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+	for _, livestreamID := range cancelledIDs {
+		invalidateNGWordMatcher(ctx, livestreamNGWordKey(livestreamID))
+	}
+
+	return c.JSON(http.StatusOK, CancelLivestreamSeriesResponse{CancelledLivestreamIDs: cancelledIDs})
+}
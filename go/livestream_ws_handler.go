@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingInterval   = wsPongWait * 9 / 10
+	wsMaxMessageSize = 4096
+	wsReplyQueueSize = 8
+
+	wsMessageTypeReaction = "reaction"
+	wsMessageTypeError    = "error"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     checkWebSocketOrigin,
+}
+
+// WebSocketでクライアントから送られてくるメッセージ
+type wsClientMessage struct {
+	Type      string `json:"type"`
+	EmojiName string `json:"emoji_name"`
+}
+
+// 配信者ごとにサブドメインが分かれているので、同一ホストに加えて u.isucon.dev 配下を許可する
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host || u.Hostname() == "u.isucon.dev" || strings.HasSuffix(u.Hostname(), ".u.isucon.dev")
+}
+
+// ライブ配信ごとのWebSocket (ライブコメント、リアクション、モデレーション、視聴者数)
+// GET /api/livestream/:livestream_id/ws
+func livestreamWebSocketHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "livestreamWebSocketHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, int64(livestreamID))
+	// 接続中はトランザクションを保持しない
+	tx.Rollback()
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+		}
+	}
+
+	conn, err := wsUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// Upgraderがエラーレスポンスを書き込み済み
+		c.Logger().Warnf("failed to upgrade websocket: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	// hijack後はリクエストのcontextがキャンセルされないので、接続単位で作り直す
+	connCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := eventHub.subscribe(livestreamModel.ID)
+	defer eventHub.unsubscribe(sub)
+
+	replies := make(chan livestreamEvent, wsReplyQueueSize)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		readWebSocketMessages(connCtx, c, conn, userID, livestreamModel.ID, replies)
+	}()
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		var ev livestreamEvent
+		select {
+		case <-readDone:
+			return nil
+		case <-sub.dropped:
+			// 送信が追いつかないクライアントは切断する
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(wsWriteWait))
+			return nil
+		case ev = <-sub.events:
+		case ev = <-replies:
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(ev); err != nil {
+			return nil
+		}
+	}
+}
+
+func readWebSocketMessages(ctx context.Context, c echo.Context, conn *websocket.Conn, userID int64, livestreamID int64, replies chan<- livestreamEvent) {
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				c.Logger().Warnf("websocket read error: %v", err)
+			}
+			return
+		}
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			replyWebSocketError(replies, livestreamID, "failed to decode the message as json")
+			continue
+		}
+
+		switch msg.Type {
+		case wsMessageTypeReaction:
+			// 登録したリアクションはhub経由で自分にも届く
+			if _, err := insertReaction(ctx, userID, livestreamID, msg.EmojiName); err != nil {
+				replyWebSocketError(replies, livestreamID, err.Error())
+			}
+		default:
+			replyWebSocketError(replies, livestreamID, "unknown message type: "+msg.Type)
+		}
+	}
+}
+
+func replyWebSocketError(replies chan<- livestreamEvent, livestreamID int64, message string) {
+	data, err := json.Marshal(&ErrorResponse{Error: message})
+	if err != nil {
+		return
+	}
+	select {
+	case replies <- livestreamEvent{LivestreamID: livestreamID, Type: wsMessageTypeError, Data: data}:
+	default:
+	}
+}
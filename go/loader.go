@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/isucon/isucon13/webapp/go/store"
+	"github.com/isucon/isucon13/webapp/go/trace"
+)
+
+// responseLoader 一覧のレスポンスを組み立てる際に、ユーザ・テーマ・配信・タグをIN句でまとめて取得する
+// リクエスト(トランザクション)ごとに作成し、取得済みのものは使い回す
+type responseLoader struct {
+	tx store.Tx
+
+	users       map[int64]User
+	livestreams map[int64]Livestream
+	// 配信IDから固定されているライブコメントID
+	pins map[int64]int64
+	// 固定状態を取得済みの配信
+	pinsLoaded map[int64]struct{}
+}
+
+func newResponseLoader(tx store.Tx) *responseLoader {
+	return &responseLoader{
+		tx:          tx,
+		users:       make(map[int64]User),
+		livestreams: make(map[int64]Livestream),
+		pins:        make(map[int64]int64),
+		pinsLoaded:  make(map[int64]struct{}),
+	}
+}
+
+// uniqueIDs 重複を除いた上で、取得済みのIDを取り除く
+func uniqueIDs[V any](ids []int64, loaded map[int64]V) []int64 {
+	res := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := loaded[id]; !ok {
+			res = append(res, id)
+		}
+	}
+	slices.Sort(res)
+	return slices.Compact(res)
+}
+
+func (l *responseLoader) loadUsers(ctx context.Context, userIDs []int64) error {
+	ids := uniqueIDs(userIDs, l.users)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	userModels, err := l.tx.Users().GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	themeModels, err := l.tx.Users().GetThemesByUserIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	themes := make(map[int64]ThemeModel, len(themeModels))
+	for _, themeModel := range themeModels {
+		themes[themeModel.UserID] = themeModel
+	}
+
+	for _, userModel := range userModels {
+		themeModel, ok := themes[userModel.ID]
+		if !ok {
+			return fmt.Errorf("theme of user %d: %w", userModel.ID, sql.ErrNoRows)
+		}
+		user, err := newUserResponse(userModel, themeModel)
+		if err != nil {
+			return err
+		}
+		l.users[userModel.ID] = user
+	}
+	return nil
+}
+
+func (l *responseLoader) user(userID int64) (User, error) {
+	user, ok := l.users[userID]
+	if !ok {
+		return User{}, fmt.Errorf("user %d: %w", userID, sql.ErrNoRows)
+	}
+	return user, nil
+}
+
+func (l *responseLoader) loadLivestreams(ctx context.Context, livestreamIDs []int64) error {
+	ids := uniqueIDs(livestreamIDs, l.livestreams)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	livestreamModels, err := l.tx.Livestreams().GetLivestreamsByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	return l.loadLivestreamModels(ctx, livestreamModels)
+}
+
+// loadLivestreamModels 取得済みの配信について、配信者とタグをまとめて取得する
+func (l *responseLoader) loadLivestreamModels(ctx context.Context, livestreamModels []LivestreamModel) error {
+	livestreamIDs := make([]int64, len(livestreamModels))
+	ownerIDs := make([]int64, len(livestreamModels))
+	for i := range livestreamModels {
+		livestreamIDs[i] = livestreamModels[i].ID
+		ownerIDs[i] = livestreamModels[i].UserID
+	}
+	ids := uniqueIDs(livestreamIDs, l.livestreams)
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := l.loadUsers(ctx, ownerIDs); err != nil {
+		return err
+	}
+
+	livestreamTagModels, err := l.tx.Livestreams().GetLivestreamTagsByLivestreamIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	tagIDs := make([]int64, len(livestreamTagModels))
+	for i := range livestreamTagModels {
+		tagIDs[i] = livestreamTagModels[i].TagID
+	}
+	tagModels := make(map[int64]TagModel)
+	if tagIDs = uniqueIDs(tagIDs, tagModels); len(tagIDs) > 0 {
+		models, err := l.tx.Livestreams().GetTagsByIDs(ctx, tagIDs)
+		if err != nil {
+			return err
+		}
+		for _, tagModel := range models {
+			tagModels[tagModel.ID] = tagModel
+		}
+	}
+	tags := make(map[int64][]Tag, len(ids))
+	for _, livestreamTagModel := range livestreamTagModels {
+		tagModel, ok := tagModels[livestreamTagModel.TagID]
+		if !ok {
+			return fmt.Errorf("tag %d: %w", livestreamTagModel.TagID, sql.ErrNoRows)
+		}
+		tags[livestreamTagModel.LivestreamID] = append(tags[livestreamTagModel.LivestreamID], Tag{
+			ID:   tagModel.ID,
+			Name: tagModel.Name,
+		})
+	}
+
+	for _, livestreamModel := range livestreamModels {
+		owner, err := l.user(livestreamModel.UserID)
+		if err != nil {
+			return err
+		}
+		livestreamTags := tags[livestreamModel.ID]
+		if livestreamTags == nil {
+			livestreamTags = []Tag{}
+		}
+		l.livestreams[livestreamModel.ID] = newLivestreamResponse(livestreamModel, owner, livestreamTags)
+	}
+	return nil
+}
+
+func (l *responseLoader) livestream(livestreamID int64) (Livestream, error) {
+	livestream, ok := l.livestreams[livestreamID]
+	if !ok {
+		return Livestream{}, fmt.Errorf("livestream %d: %w", livestreamID, sql.ErrNoRows)
+	}
+	return livestream, nil
+}
+
+func (l *responseLoader) loadPins(ctx context.Context, livestreamIDs []int64) error {
+	ids := uniqueIDs(livestreamIDs, l.pinsLoaded)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pinModels, err := l.tx.Livecomments().GetPinsByLivestreamIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, pinModel := range pinModels {
+		l.pins[pinModel.LivestreamID] = pinModel.LivecommentID
+	}
+	for _, id := range ids {
+		l.pinsLoaded[id] = struct{}{}
+	}
+	return nil
+}
+
+func (l *responseLoader) isPinned(livecommentModel LivecommentModel) bool {
+	livecommentID, ok := l.pins[livecommentModel.LivestreamID]
+	return ok && livecommentID == livecommentModel.ID
+}
+
+// fillLivestreamResponses fillLivestreamResponseの一覧版
+func fillLivestreamResponses(ctx context.Context, tx store.Tx, livestreamModels []LivestreamModel) ([]Livestream, error) {
+	trace.StartSpan(ctx, "fillLivestreamResponses")
+	defer trace.EndSpan(ctx, nil)
+
+	loader := newResponseLoader(tx)
+	if err := loader.loadLivestreamModels(ctx, livestreamModels); err != nil {
+		return nil, err
+	}
+
+	livestreams := make([]Livestream, len(livestreamModels))
+	for i := range livestreamModels {
+		livestream, err := loader.livestream(livestreamModels[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		livestreams[i] = livestream
+	}
+	return livestreams, nil
+}
+
+// fillLivecommentResponses fillLivecommentResponseの一覧版
+func fillLivecommentResponses(ctx context.Context, tx store.Tx, livecommentModels []LivecommentModel) ([]Livecomment, error) {
+	trace.StartSpan(ctx, "fillLivecommentResponses")
+	defer trace.EndSpan(ctx, nil)
+
+	return newResponseLoader(tx).livecomments(ctx, livecommentModels)
+}
+
+func (l *responseLoader) livecomments(ctx context.Context, livecommentModels []LivecommentModel) ([]Livecomment, error) {
+	userIDs := make([]int64, len(livecommentModels))
+	livestreamIDs := make([]int64, len(livecommentModels))
+	for i := range livecommentModels {
+		userIDs[i] = livecommentModels[i].UserID
+		livestreamIDs[i] = livecommentModels[i].LivestreamID
+	}
+	if err := l.loadUsers(ctx, userIDs); err != nil {
+		return nil, err
+	}
+	if err := l.loadLivestreams(ctx, livestreamIDs); err != nil {
+		return nil, err
+	}
+	if err := l.loadPins(ctx, livestreamIDs); err != nil {
+		return nil, err
+	}
+
+	livecomments := make([]Livecomment, len(livecommentModels))
+	for i, livecommentModel := range livecommentModels {
+		commentOwner, err := l.user(livecommentModel.UserID)
+		if err != nil {
+			return nil, err
+		}
+		livestream, err := l.livestream(livecommentModel.LivestreamID)
+		if err != nil {
+			return nil, err
+		}
+		livecomments[i] = newLivecommentResponse(livecommentModel, commentOwner, livestream, l.isPinned(livecommentModel))
+	}
+	return livecomments, nil
+}
+
+// fillReactionResponses fillReactionResponseの一覧版
+func fillReactionResponses(ctx context.Context, tx store.Tx, reactionModels []ReactionModel) ([]Reaction, error) {
+	trace.StartSpan(ctx, "fillReactionResponses")
+	defer trace.EndSpan(ctx, nil)
+
+	loader := newResponseLoader(tx)
+	userIDs := make([]int64, len(reactionModels))
+	livestreamIDs := make([]int64, len(reactionModels))
+	for i := range reactionModels {
+		userIDs[i] = reactionModels[i].UserID
+		livestreamIDs[i] = reactionModels[i].LivestreamID
+	}
+	if err := loader.loadUsers(ctx, userIDs); err != nil {
+		return nil, err
+	}
+	if err := loader.loadLivestreams(ctx, livestreamIDs); err != nil {
+		return nil, err
+	}
+
+	reactions := make([]Reaction, len(reactionModels))
+	for i, reactionModel := range reactionModels {
+		user, err := loader.user(reactionModel.UserID)
+		if err != nil {
+			return nil, err
+		}
+		livestream, err := loader.livestream(reactionModel.LivestreamID)
+		if err != nil {
+			return nil, err
+		}
+		reactions[i] = newReactionResponse(reactionModel, user, livestream)
+	}
+	return reactions, nil
+}
+
+// fillLivecommentReportResponses fillLivecommentReportResponseの一覧版
+func fillLivecommentReportResponses(ctx context.Context, tx store.Tx, reportModels []LivecommentReportModel) ([]LivecommentReport, error) {
+	trace.StartSpan(ctx, "fillLivecommentReportResponses")
+	defer trace.EndSpan(ctx, nil)
+
+	loader := newResponseLoader(tx)
+	reporterIDs := make([]int64, len(reportModels))
+	livecommentIDs := make([]int64, len(reportModels))
+	for i := range reportModels {
+		reporterIDs[i] = reportModels[i].UserID
+		livecommentIDs[i] = reportModels[i].LivecommentID
+	}
+	if err := loader.loadUsers(ctx, reporterIDs); err != nil {
+		return nil, err
+	}
+
+	livecommentModels, err := tx.Livecomments().GetLivecommentsByIDs(ctx, uniqueIDs(livecommentIDs, map[int64]struct{}{}))
+	if err != nil {
+		return nil, err
+	}
+	livecomments, err := loader.livecomments(ctx, livecommentModels)
+	if err != nil {
+		return nil, err
+	}
+	livecommentIndex := make(map[int64]int, len(livecommentModels))
+	for i := range livecommentModels {
+		livecommentIndex[livecommentModels[i].ID] = i
+	}
+
+	reports := make([]LivecommentReport, len(reportModels))
+	for i, reportModel := range reportModels {
+		reporter, err := loader.user(reportModel.UserID)
+		if err != nil {
+			return nil, err
+		}
+		j, ok := livecommentIndex[reportModel.LivecommentID]
+		if !ok {
+			return nil, fmt.Errorf("livecomment %d: %w", reportModel.LivecommentID, sql.ErrNoRows)
+		}
+		reports[i] = newLivecommentReportResponse(reportModel, reporter, livecommentModels[j], livecomments[j])
+	}
+	return reports, nil
+}
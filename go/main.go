@@ -10,12 +10,12 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"strconv"
 	"time"
 
 	"cloud.google.com/go/profiler"
 	"github.com/go-sql-driver/mysql"
+	"github.com/isucon/isucon13/webapp/go/store"
 	"github.com/isucon/isucon13/webapp/go/trace"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
@@ -30,12 +30,16 @@ import (
 const (
 	listenPort                     = 8080
 	powerDNSSubdomainAddressEnvKey = "ISUCON13_POWERDNS_SUBDOMAIN_ADDRESS"
+	powerDNSDisabledEnvKey         = "ISUCON13_POWERDNS_DISABLED"
 )
 
 var (
-	powerDNSSubdomainAddress string
-	dbConn                   *sqlx.DB
-	secret                   = []byte("isucon13_session_cookiestore_defaultsecret")
+	// subdomainZone ユーザ登録時にサブドメインを追加するDNSゾーン
+	subdomainZone dnsZone
+	// dbConn 初期化(マイグレーションと初期データ投入)のみで使う. ハンドラはappStoreを使う
+	dbConn   *sqlx.DB
+	appStore store.Store
+	secret   = []byte("isucon13_session_cookiestore_defaultsecret")
 )
 
 func init() {
@@ -116,17 +120,10 @@ func connectDB(logger echo.Logger) (*sqlx.DB, error) {
 func initializeHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	if out, err := exec.Command("../sql/init.sh").CombinedOutput(); err != nil {
-		c.Logger().Warnf("init.sh failed with err=%s", string(out))
+	if err := initializeData(ctx, c.Logger()); err != nil {
+		c.Logger().Warnf("failed to initialize: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to initialize: "+err.Error())
 	}
-	if err := os.RemoveAll("public/icons/users/"); err != nil {
-		c.Logger().Warnf("failed to remove icons: %v", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to initialize(remove public): "+err.Error())
-	}
-	if err := rdb.FlushDB(ctx).Err(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to flush redis: "+err.Error())
-	}
 
 	c.Request().Header.Add("Content-Type", "application/json;charset=utf-8")
 	return c.JSON(http.StatusOK, InitializeResponse{
@@ -147,6 +144,15 @@ func init() {
 }
 
 func main() {
+	// isupipe migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+	// isupipe reservation extend UNTIL
+	if len(os.Args) > 1 && os.Args[1] == "reservation" {
+		os.Exit(runReservationCommand(os.Args[2:]))
+	}
+
 	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "/home/isucon/webapp/isu13_credential.json")
 	now := time.Now()
 	if err := profiler.Start(profiler.Config{
@@ -163,6 +169,60 @@ func main() {
 	}
 	defer shutdown(context.Background())
 
+	e := newEcho()
+
+	if err := loadReservationConfig(); err != nil {
+		e.Logger.Errorf("failed to load reservation config: %v", err)
+		os.Exit(1)
+	}
+	if err := loadRateLimitConfig(); err != nil {
+		e.Logger.Errorf("failed to load rate limit config: %v", err)
+		os.Exit(1)
+	}
+
+	// DB接続
+	conn, err := connectDB(e.Logger)
+	if err != nil {
+		e.Logger.Errorf("failed to connect db: %v", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	dbConn = conn
+	appStore = store.NewMySQL(conn)
+
+	// initdb.dはデータベースしか作らないので、テーブルは起動時にマイグレーションで作成する
+	if err := applyMigrations(context.Background(), e.Logger); err != nil {
+		e.Logger.Errorf("failed to apply migrations: %v", err)
+		os.Exit(1)
+	}
+
+	// PowerDNSのない環境では、サブドメインの登録とゾーンの初期化を行わない
+	if _, ok := os.LookupEnv(powerDNSDisabledEnvKey); ok {
+		subdomainZone = noopZone{}
+	} else {
+		subdomainAddr, ok := os.LookupEnv(powerDNSSubdomainAddressEnvKey)
+		if !ok {
+			e.Logger.Errorf("environ %s must be provided", powerDNSSubdomainAddressEnvKey)
+			os.Exit(1)
+		}
+		subdomainZone = &pdnsutilZone{zone: "u.isucon.dev", address: subdomainAddr, zoneFile: "../pdns/u.isucon.dev.zone"}
+	}
+
+	// 他のアプリケーションサーバで発生したイベントを受け取る
+	go eventHub.run(context.Background())
+	go subscribeNGWordInvalidation(context.Background())
+
+	// HTTPサーバ起動
+	listenAddr := net.JoinHostPort("", strconv.Itoa(listenPort))
+	if err := e.Start(listenAddr); err != nil {
+		e.Logger.Errorf("failed to start HTTP server: %v", err)
+		os.Exit(1)
+	}
+}
+
+// newEcho ミドルウェアとルーティングを設定したechoを返す
+// テストからも同じルーティングで叩けるようにmainから分けている
+func newEcho() *echo.Echo {
 	e := echo.New()
 	e.Debug = true
 	e.Logger.SetLevel(echolog.DEBUG)
@@ -182,27 +242,71 @@ func main() {
 	// livestream
 	// reserve livestream
 	e.POST("/api/livestream/reservation", reserveLivestreamHandler)
+	// 予約枠の空き状況
+	e.GET("/api/reservation/slots", getReservationSlotsHandler)
+	e.GET("/api/reservation/slots/available", getFirstAvailableReservationWindowHandler)
 	// list livestream
 	e.GET("/api/livestream/search", searchLivestreamsHandler)
 	e.GET("/api/livestream", getMyLivestreamsHandler)
 	e.GET("/api/user/:username/livestream", getUserLivestreamsHandler)
 	// get livestream
 	e.GET("/api/livestream/:livestream_id", getLivestreamHandler)
+	// 配信予約の変更と、開始前の配信予約の取り消し
+	e.PATCH("/api/livestream/:livestream_id", patchLivestreamHandler)
+	e.DELETE("/api/livestream/:livestream_id", cancelLivestreamHandler)
+	// 繰り返し予約のうち、開始前の回をまとめて取り消す
+	e.DELETE("/api/livestream/series/:series_id", cancelLivestreamSeriesHandler)
 	// get polling livecomment timeline
 	e.GET("/api/livestream/:livestream_id/livecomment", getLivecommentsHandler)
+	// SSEによるライブコメント配信
+	e.GET("/api/livestream/:livestream_id/livecomment/stream", streamLivecommentsHandler)
+	// ライブコメント、リアクション、視聴者数をまとめて配信するWebSocket
+	e.GET("/api/livestream/:livestream_id/ws", livestreamWebSocketHandler)
 	// ライブコメント投稿
 	e.POST("/api/livestream/:livestream_id/livecomment", postLivecommentHandler)
+	// 固定されたライブコメントとチップ付きライブコメントのハイライト
+	e.GET("/api/livestream/:livestream_id/livecomment/highlighted", getHighlightedLivecommentsHandler)
+	e.PUT("/api/livestream/:livestream_id/pin", pinLivecommentHandler)
+	e.DELETE("/api/livestream/:livestream_id/pin", unpinLivecommentHandler)
+	// 投稿者によるライブコメントの編集・削除
+	e.PATCH("/api/livestream/:livestream_id/livecomment/:livecomment_id", patchLivecommentHandler)
+	e.DELETE("/api/livestream/:livestream_id/livecomment/:livecomment_id", deleteLivecommentHandler)
 	e.POST("/api/livestream/:livestream_id/reaction", postReactionHandler)
 	e.GET("/api/livestream/:livestream_id/reaction", getReactionsHandler)
 
 	// (配信者向け)ライブコメントの報告一覧取得API
 	e.GET("/api/livestream/:livestream_id/report", getLivecommentReportsHandler)
 	e.GET("/api/livestream/:livestream_id/ngwords", getNgwords)
+	// 配信者によるNGワードの修正・削除
+	e.PUT("/api/livestream/:livestream_id/ngwords/:ngword_id", updateNgwordHandler)
+	e.DELETE("/api/livestream/:livestream_id/ngwords/:ngword_id", deleteNgwordHandler)
 	// ライブコメント報告
 	e.POST("/api/livestream/:livestream_id/livecomment/:livecomment_id/report", reportLivecommentHandler)
+	// 配信者による報告への対応
+	e.POST("/api/livestream/:livestream_id/report/:report_id/resolve", resolveLivecommentReportHandler)
 	// 配信者によるモデレーション (NGワード登録)
 	e.POST("/api/livestream/:livestream_id/moderate", moderateHandler)
 
+	// 配信者によるモデレーターの任命
+	e.GET("/api/livestream/:livestream_id/moderators", getModeratorsHandler)
+	e.POST("/api/livestream/:livestream_id/moderators", postModeratorHandler)
+	e.DELETE("/api/livestream/:livestream_id/moderators/:moderator_id", deleteModeratorHandler)
+	// 配信者・モデレーターによるユーザのBAN・タイムアウト
+	e.GET("/api/livestream/:livestream_id/ban", getUserBansHandler)
+	e.POST("/api/livestream/:livestream_id/ban", postUserBanHandler)
+	e.DELETE("/api/livestream/:livestream_id/ban/:ban_id", deleteUserBanHandler)
+	// 配信者によるモデレーションの履歴と取り消し
+	e.GET("/api/livestream/:livestream_id/moderation/logs", getModerationLogsHandler)
+	e.POST("/api/livestream/:livestream_id/moderation/logs/:moderation_log_id/revert", revertModerationLogHandler)
+	// 報告数による自動非表示などの配信ごとの設定
+	e.GET("/api/livestream/:livestream_id/moderation/settings", getModerationSettingsHandler)
+	e.PUT("/api/livestream/:livestream_id/moderation/settings", putModerationSettingsHandler)
+
+	// 運営による全配信共通のNGワード
+	e.GET("/api/admin/ngwords", getGlobalNGWordsHandler)
+	e.POST("/api/admin/ngwords", postGlobalNGWordHandler)
+	e.DELETE("/api/admin/ngwords/:ngword_id", deleteGlobalNGWordHandler)
+
 	// livestream_viewersにINSERTするため必要
 	// ユーザ視聴開始 (viewer)
 	e.POST("/api/livestream/:livestream_id/enter", enterLivestreamHandler)
@@ -228,28 +332,7 @@ func main() {
 
 	e.HTTPErrorHandler = errorResponseHandler
 
-	// DB接続
-	conn, err := connectDB(e.Logger)
-	if err != nil {
-		e.Logger.Errorf("failed to connect db: %v", err)
-		os.Exit(1)
-	}
-	defer conn.Close()
-	dbConn = conn
-
-	subdomainAddr, ok := os.LookupEnv(powerDNSSubdomainAddressEnvKey)
-	if !ok {
-		e.Logger.Errorf("environ %s must be provided", powerDNSSubdomainAddressEnvKey)
-		os.Exit(1)
-	}
-	powerDNSSubdomainAddress = subdomainAddr
-
-	// HTTPサーバ起動
-	listenAddr := net.JoinHostPort("", strconv.Itoa(listenPort))
-	if err := e.Start(listenAddr); err != nil {
-		e.Logger.Errorf("failed to start HTTP server: %v", err)
-		os.Exit(1)
-	}
+	return e
 }
 
 type ErrorResponse struct {
@@ -0,0 +1,1250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/goccy/go-json"
+	"github.com/isucon/isucon13/webapp/go/store"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// 予約期間内の適当な時刻
+var testReserveStartAt = time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC).Unix()
+
+type fakeDNSZone struct {
+	names []string
+}
+
+func (z *fakeDNSZone) AddRecord(ctx context.Context, name string) error {
+	z.names = append(z.names, name)
+	return nil
+}
+
+func (z *fakeDNSZone) Reset(ctx context.Context) error {
+	z.names = nil
+	return nil
+}
+
+type testServer struct {
+	t     *testing.T
+	e     *echo.Echo
+	store *store.Memory
+	dns   *fakeDNSZone
+}
+
+// newTestServer mainと同じルーティングのechoを、メモリ上のStoreと偽のDNSで組み立てる.
+// Redisはテストごとにminiredisを立てる
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	s := &testServer{
+		t:     t,
+		store: store.NewMemory(),
+		dns:   &fakeDNSZone{},
+	}
+	appStore = s.store
+	subdomainZone = s.dns
+	// メモリ上のStoreは毎回IDを1から振るので、前のテストのNGワードを引きずらないようにする
+	ngwordMatchers.Purge()
+	rdb = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	s.e = newEcho()
+	return s
+}
+
+func (s *testServer) do(method, path string, body any, cookie *http.Cookie) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	// セッションのCookieはu.isucon.dev向けなので、テストでは明示的に付与する
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *testServer) register(name string) User {
+	s.t.Helper()
+
+	rec := s.do(http.MethodPost, "/api/register", PostUserRequest{
+		Name:        name,
+		DisplayName: name + " display",
+		Description: name + " description",
+		Password:    "password-" + name,
+		Theme:       PostUserRequestTheme{DarkMode: true},
+	}, nil)
+	if rec.Code != http.StatusCreated {
+		s.t.Fatalf("register %s: status = %d, body = %s", name, rec.Code, rec.Body)
+	}
+	return decodeBody[User](s.t, rec)
+}
+
+func (s *testServer) login(name string) *http.Cookie {
+	s.t.Helper()
+
+	rec := s.do(http.MethodPost, "/api/login", LoginRequest{
+		Username: name,
+		Password: "password-" + name,
+	}, nil)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("login %s: status = %d, body = %s", name, rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 {
+		s.t.Fatalf("login %s: no session cookie", name)
+	}
+	return cookies[0]
+}
+
+// reserve 予約枠を用意した上で、指定した時間から1時間の配信を予約する
+func (s *testServer) reserve(cookie *http.Cookie, startAt int64, tags []int64) Livestream {
+	s.t.Helper()
+
+	s.store.InsertReservationSlots(store.ReservationSlot{Slot: 1, StartAt: startAt, EndAt: startAt + 3600})
+	rec := s.do(http.MethodPost, "/api/livestream/reservation", ReserveLivestreamRequest{
+		Tags:    tags,
+		Title:   "title",
+		StartAt: startAt,
+		EndAt:   startAt + 3600,
+	}, cookie)
+	if rec.Code != http.StatusCreated {
+		s.t.Fatalf("reserve: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	return decodeBody[Livestream](s.t, rec)
+}
+
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to decode %s: %v", rec.Body, err)
+	}
+	return v
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d, body = %s", rec.Code, want, rec.Body)
+	}
+}
+
+func livestreamPath(livestreamID int64, suffix string) string {
+	return "/api/livestream/" + strconv.FormatInt(livestreamID, 10) + suffix
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	user := s.register("alice")
+	if user.Name != "alice" || !user.Theme.DarkMode || user.IconHash != fallbackHash {
+		t.Errorf("unexpected user: %+v", user)
+	}
+	if len(s.dns.names) != 1 || s.dns.names[0] != "alice" {
+		t.Errorf("dns records = %v, want [alice]", s.dns.names)
+	}
+
+	rec := s.do(http.MethodPost, "/api/register", PostUserRequest{Name: "pipe", Password: "pipe"}, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = s.do(http.MethodPost, "/api/login", LoginRequest{Username: "alice", Password: "wrong"}, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	rec = s.do(http.MethodPost, "/api/login", LoginRequest{Username: "bob", Password: "password-bob"}, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = s.do(http.MethodGet, "/api/user/me", nil, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	cookie := s.login("alice")
+	rec = s.do(http.MethodGet, "/api/user/me", nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+	if me := decodeBody[User](t, rec); me.ID != user.ID {
+		t.Errorf("me = %+v, want id %d", me, user.ID)
+	}
+}
+
+func TestGetUserAndTheme(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.register("alice")
+	s.register("bob")
+	cookie := s.login("bob")
+
+	rec := s.do(http.MethodGet, "/api/user/alice", nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeBody[User](t, rec); got.ID != alice.ID || got.DisplayName != "alice display" {
+		t.Errorf("user = %+v", got)
+	}
+
+	rec = s.do(http.MethodGet, "/api/user/carol", nil, cookie)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = s.do(http.MethodGet, "/api/user/alice/theme", nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+	if theme := decodeBody[Theme](t, rec); !theme.DarkMode {
+		t.Errorf("theme = %+v, want dark mode", theme)
+	}
+}
+
+func TestReserveAndSearchLivestreams(t *testing.T) {
+	s := newTestServer(t)
+	s.store.InsertTags("ライブ配信", "ゲーム実況")
+	s.register("alice")
+	cookie := s.login("alice")
+
+	rec := s.do(http.MethodGet, "/api/tag", nil, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if tags := decodeBody[TagsResponse](t, rec); len(tags.Tags) != 2 {
+		t.Errorf("tags = %+v", tags)
+	}
+
+	livestream := s.reserve(cookie, testReserveStartAt, []int64{2})
+	if livestream.Owner.Name != "alice" || len(livestream.Tags) != 1 || livestream.Tags[0].Name != "ゲーム実況" {
+		t.Errorf("unexpected livestream: %+v", livestream)
+	}
+
+	t.Run("予約枠を使い切ると予約できない", func(t *testing.T) {
+		rec := s.do(http.MethodPost, "/api/livestream/reservation", ReserveLivestreamRequest{
+			StartAt: testReserveStartAt,
+			EndAt:   testReserveStartAt + 3600,
+		}, cookie)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("期間外は予約できない", func(t *testing.T) {
+		startAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+		rec := s.do(http.MethodPost, "/api/livestream/reservation", ReserveLivestreamRequest{
+			StartAt: startAt,
+			EndAt:   startAt + 3600,
+		}, cookie)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	other := s.reserve(cookie, testReserveStartAt+3600, nil)
+
+	t.Run("タグで検索", func(t *testing.T) {
+		rec := s.do(http.MethodGet, "/api/livestream/search?tag="+url.QueryEscape("ゲーム実況"), nil, cookie)
+		expectStatus(t, rec, http.StatusOK)
+		livestreams := decodeBody[[]Livestream](t, rec)
+		if len(livestreams) != 1 || livestreams[0].ID != livestream.ID {
+			t.Errorf("livestreams = %+v", livestreams)
+		}
+	})
+
+	t.Run("新しい順に一覧", func(t *testing.T) {
+		rec := s.do(http.MethodGet, "/api/livestream/search", nil, cookie)
+		expectStatus(t, rec, http.StatusOK)
+		livestreams := decodeBody[[]Livestream](t, rec)
+		if len(livestreams) != 2 || livestreams[0].ID != other.ID || livestreams[1].ID != livestream.ID {
+			t.Errorf("livestreams = %+v", livestreams)
+		}
+	})
+
+	t.Run("自分の配信", func(t *testing.T) {
+		rec := s.do(http.MethodGet, "/api/livestream", nil, cookie)
+		expectStatus(t, rec, http.StatusOK)
+		if livestreams := decodeBody[[]Livestream](t, rec); len(livestreams) != 2 {
+			t.Errorf("livestreams = %+v", livestreams)
+		}
+	})
+
+	t.Run("配信の取得", func(t *testing.T) {
+		rec := s.do(http.MethodGet, livestreamPath(livestream.ID, ""), nil, cookie)
+		expectStatus(t, rec, http.StatusOK)
+		if got := decodeBody[Livestream](t, rec); got.ID != livestream.ID || got.Title != "title" {
+			t.Errorf("livestream = %+v", got)
+		}
+
+		rec = s.do(http.MethodGet, livestreamPath(100, ""), nil, cookie)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+}
+
+func TestGetLivecomments(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	bob := s.register("bob")
+	cookie := s.login("alice")
+	livestream := s.reserve(cookie, testReserveStartAt, nil)
+
+	s.store.InsertLivecomments(
+		store.Livecomment{UserID: bob.ID, LivestreamID: livestream.ID, Comment: "1", CreatedAt: 100},
+		store.Livecomment{UserID: bob.ID, LivestreamID: livestream.ID, Comment: "2", CreatedAt: 100, Tip: 500},
+		store.Livecomment{UserID: bob.ID, LivestreamID: livestream.ID, Comment: "3", CreatedAt: 101, HiddenAt: sql.NullInt64{Int64: 102, Valid: true}},
+		store.Livecomment{UserID: bob.ID, LivestreamID: livestream.ID, Comment: "4", CreatedAt: 103},
+	)
+	s.store.InsertPins(store.LivestreamPin{LivestreamID: livestream.ID, LivecommentID: 1, PinnedBy: livestream.Owner.ID, PinnedAt: 104})
+
+	rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/livecomment"), nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+	livecomments := decodeBody[[]Livecomment](t, rec)
+	var comments []string
+	for _, livecomment := range livecomments {
+		comments = append(comments, livecomment.Comment)
+	}
+	if len(comments) != 3 || comments[0] != "4" || comments[1] != "2" || comments[2] != "1" {
+		t.Fatalf("comments = %v, want [4 2 1]", comments)
+	}
+	if !livecomments[2].Pinned || livecomments[0].Pinned {
+		t.Errorf("pinned = %v, %v", livecomments[0].Pinned, livecomments[2].Pinned)
+	}
+	if livecomments[1].HighlightUntil == nil || livecomments[2].HighlightUntil != nil {
+		t.Errorf("highlight_until = %v, %v", livecomments[1].HighlightUntil, livecomments[2].HighlightUntil)
+	}
+	if livecomments[0].User.ID != bob.ID || livecomments[0].Livestream.ID != livestream.ID {
+		t.Errorf("livecomment = %+v", livecomments[0])
+	}
+
+	t.Run("ページ送り", func(t *testing.T) {
+		rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/livecomment?limit=2&before="), nil, cookie)
+		expectStatus(t, rec, http.StatusOK)
+		page := decodeBody[LivecommentsPage](t, rec)
+		if len(page.Livecomments) != 2 || page.NextCursor == nil {
+			t.Fatalf("page = %+v", page)
+		}
+
+		rec = s.do(http.MethodGet, livestreamPath(livestream.ID, "/livecomment?limit=2&before="+*page.NextCursor), nil, cookie)
+		expectStatus(t, rec, http.StatusOK)
+		page = decodeBody[LivecommentsPage](t, rec)
+		if len(page.Livecomments) != 1 || page.Livecomments[0].Comment != "1" || page.NextCursor != nil {
+			t.Errorf("page = %+v", page)
+		}
+	})
+
+	t.Run("カーソルなしのlimitには上限を設けない", func(t *testing.T) {
+		q, err := parsePageQuery(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/?limit=200", nil), nil))
+		if err != nil || q.Limit != 200 || q.Paginated {
+			t.Errorf("query = %+v, err = %v", q, err)
+		}
+		q, err = parsePageQuery(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/?limit=200&before=", nil), nil))
+		if err != nil || q.Limit != maxPageLimit || !q.Paginated {
+			t.Errorf("query = %+v, err = %v", q, err)
+		}
+
+		// 従来通り0以下も受け付け、LIMIT 0と同じく1件も返さない
+		rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/livecomment?limit=0"), nil, cookie)
+		expectStatus(t, rec, http.StatusOK)
+		if livecomments := decodeBody[[]Livecomment](t, rec); len(livecomments) != 0 {
+			t.Errorf("livecomments = %+v", livecomments)
+		}
+		rec = s.do(http.MethodGet, livestreamPath(livestream.ID, "/livecomment?limit=0&before="), nil, cookie)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("ログインしていない", func(t *testing.T) {
+		rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/livecomment"), nil, nil)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+}
+
+func TestGetReactions(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	cookie := s.login("alice")
+	livestream := s.reserve(cookie, testReserveStartAt, nil)
+
+	s.store.InsertReactions(
+		store.Reaction{UserID: livestream.Owner.ID, LivestreamID: livestream.ID, EmojiName: "innocent", CreatedAt: 100},
+		store.Reaction{UserID: livestream.Owner.ID, LivestreamID: livestream.ID, EmojiName: "tada", CreatedAt: 101},
+	)
+
+	rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/reaction?limit=1"), nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+	reactions := decodeBody[[]Reaction](t, rec)
+	if len(reactions) != 1 || reactions[0].EmojiName != "tada" || reactions[0].User.Name != "alice" {
+		t.Errorf("reactions = %+v", reactions)
+	}
+}
+
+func TestGetLivecommentReports(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	bob := s.register("bob")
+	carol := s.register("carol")
+	aliceCookie := s.login("alice")
+	bobCookie := s.login("bob")
+	livestream := s.reserve(aliceCookie, testReserveStartAt, nil)
+
+	s.store.InsertLivecomments(store.Livecomment{UserID: livestream.Owner.ID, LivestreamID: livestream.ID, Comment: "hello", CreatedAt: 100})
+	s.store.InsertReports(
+		store.LivecommentReport{UserID: bob.ID, LivestreamID: livestream.ID, LivecommentID: 1, CreatedAt: 101, Status: "open"},
+		store.LivecommentReport{UserID: carol.ID, LivestreamID: livestream.ID, LivecommentID: 1, CreatedAt: 102, Status: "dismissed"},
+	)
+
+	rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/report"), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusOK)
+	if reports := decodeBody[[]LivecommentReport](t, rec); len(reports) != 2 || reports[0].Reporter.ID != bob.ID || reports[0].Livecomment.Comment != "hello" {
+		t.Errorf("reports = %+v", reports)
+	}
+
+	rec = s.do(http.MethodGet, livestreamPath(livestream.ID, "/report?status=open"), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusOK)
+	if reports := decodeBody[[]LivecommentReport](t, rec); len(reports) != 1 || reports[0].Status != "open" {
+		t.Errorf("reports = %+v", reports)
+	}
+
+	rec = s.do(http.MethodGet, livestreamPath(livestream.ID, "/report"), nil, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	t.Run("報告対応の権限を持つモデレーター", func(t *testing.T) {
+		s.store.InsertModerators(store.Moderator{
+			StreamerID:  livestream.Owner.ID,
+			UserID:      bob.ID,
+			Scope:       "channel",
+			Permissions: permissionViewReports,
+		})
+		rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/report"), nil, bobCookie)
+		expectStatus(t, rec, http.StatusOK)
+	})
+}
+
+func TestGetNgwords(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	bob := s.register("bob")
+	s.register("carol")
+	cookie := s.login("alice")
+	livestream := s.reserve(cookie, testReserveStartAt, nil)
+	other := s.reserve(cookie, testReserveStartAt+3600, nil)
+
+	s.store.InsertNGWords(
+		store.NGWord{UserID: livestream.Owner.ID, LivestreamID: livestream.ID, Word: "配信", Scope: "livestream", CreatedAt: 100},
+		store.NGWord{UserID: livestream.Owner.ID, LivestreamID: other.ID, Word: "別の配信", Scope: "livestream", CreatedAt: 101},
+		store.NGWord{UserID: livestream.Owner.ID, Word: "チャンネル", Scope: "channel", CreatedAt: 102},
+		store.NGWord{Word: "全体", Scope: "global", CreatedAt: 103},
+	)
+
+	rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/ngwords"), nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+	ngWords := decodeBody[[]NGWord](t, rec)
+	var words []string
+	for _, ngWord := range ngWords {
+		words = append(words, ngWord.Word)
+	}
+	if len(words) != 3 || words[0] != "全体" || words[1] != "チャンネル" || words[2] != "配信" {
+		t.Errorf("words = %v, want [全体 チャンネル 配信]", words)
+	}
+
+	t.Run("モデレーターには配信者のNGワードを返す", func(t *testing.T) {
+		s.store.InsertModerators(store.Moderator{StreamerID: livestream.Owner.ID, UserID: bob.ID, LivestreamID: livestream.ID, Scope: "livestream", Permissions: permissionManageNGWords})
+		rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/ngwords"), nil, s.login("bob"))
+		expectStatus(t, rec, http.StatusOK)
+		if ngWords := decodeBody[[]NGWord](t, rec); len(ngWords) != 3 {
+			t.Errorf("ng words = %+v", ngWords)
+		}
+	})
+
+	t.Run("配信者でもモデレーターでもない", func(t *testing.T) {
+		rec := s.do(http.MethodGet, livestreamPath(livestream.ID, "/ngwords"), nil, s.login("carol"))
+		expectStatus(t, rec, http.StatusForbidden)
+		rec = s.do(http.MethodGet, livestreamPath(other.ID+1, "/ngwords"), nil, cookie)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+}
+
+func TestExitLivestream(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	bob := s.register("bob")
+	cookie := s.login("bob")
+	livestream := s.reserve(s.login("alice"), testReserveStartAt, nil)
+
+	s.store.InsertViewers(
+		store.LivestreamViewer{UserID: bob.ID, LivestreamID: livestream.ID, CreatedAt: 100},
+		store.LivestreamViewer{UserID: livestream.Owner.ID, LivestreamID: livestream.ID, CreatedAt: 100},
+	)
+
+	rec := s.do(http.MethodDelete, livestreamPath(livestream.ID, "/exit"), nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+
+	tx, err := s.store.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if count, err := tx.Livestreams().CountViewers(context.Background(), livestream.ID); err != nil || count != 1 {
+		t.Errorf("viewers = %d, %v, want 1", count, err)
+	}
+}
+
+func TestPostLivecomment(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	bob := s.register("bob")
+	cookie := s.login("bob")
+	livestream := s.reserve(s.login("alice"), testReserveStartAt, nil)
+
+	rec := s.do(http.MethodPost, livestreamPath(livestream.ID, "/livecomment"), PostLivecommentRequest{Comment: "hello", Tip: 100}, cookie)
+	expectStatus(t, rec, http.StatusCreated)
+	livecomment := decodeBody[Livecomment](t, rec)
+	if livecomment.Comment != "hello" || livecomment.Tip != 100 || livecomment.User.ID != bob.ID || livecomment.Livestream.ID != livestream.ID {
+		t.Errorf("livecomment = %+v", livecomment)
+	}
+	// 統計のチップのランキングはRedisのカウンタを読む
+	if tip, err := rdb.Get(context.Background(), "livecomment:tip:"+strconv.FormatInt(bob.ID, 10)).Int64(); err != nil || tip != 100 {
+		t.Errorf("tip counter = %d, %v", tip, err)
+	}
+
+	rec = s.do(http.MethodGet, livestreamPath(livestream.ID, "/livecomment"), nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+	if livecomments := decodeBody[[]Livecomment](t, rec); len(livecomments) != 1 || livecomments[0].ID != livecomment.ID {
+		t.Errorf("livecomments = %+v", livecomments)
+	}
+
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID+1, "/livecomment"), PostLivecommentRequest{Comment: "hello"}, cookie)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestPostReaction(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	bob := s.register("bob")
+	cookie := s.login("bob")
+	livestream := s.reserve(s.login("alice"), testReserveStartAt, nil)
+
+	rec := s.do(http.MethodPost, livestreamPath(livestream.ID, "/reaction"), PostReactionRequest{EmojiName: "tada"}, cookie)
+	expectStatus(t, rec, http.StatusCreated)
+	if reaction := decodeBody[Reaction](t, rec); reaction.EmojiName != "tada" || reaction.User.ID != bob.ID || reaction.Livestream.ID != livestream.ID {
+		t.Errorf("reaction = %+v", reaction)
+	}
+
+	rec = s.do(http.MethodGet, livestreamPath(livestream.ID, "/reaction"), nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+	if reactions := decodeBody[[]Reaction](t, rec); len(reactions) != 1 || reactions[0].EmojiName != "tada" {
+		t.Errorf("reactions = %+v", reactions)
+	}
+}
+
+func TestEnterLivestream(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	s.register("bob")
+	cookie := s.login("bob")
+	livestream := s.reserve(s.login("alice"), testReserveStartAt, nil)
+
+	rec := s.do(http.MethodPost, livestreamPath(livestream.ID, "/enter"), nil, cookie)
+	expectStatus(t, rec, http.StatusOK)
+
+	tx, err := s.store.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if count, err := tx.Livestreams().CountViewers(context.Background(), livestream.ID); err != nil || count != 1 {
+		t.Errorf("viewers = %d, %v, want 1", count, err)
+	}
+}
+
+func TestReportLivecomment(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	bob := s.register("bob")
+	aliceCookie := s.login("alice")
+	bobCookie := s.login("bob")
+	livestream := s.reserve(aliceCookie, testReserveStartAt, nil)
+
+	s.store.InsertLivecomments(
+		store.Livecomment{UserID: livestream.Owner.ID, LivestreamID: livestream.ID, Comment: "hello", CreatedAt: 100},
+		store.Livecomment{UserID: livestream.Owner.ID, LivestreamID: livestream.ID, Comment: "hidden", CreatedAt: 100, HiddenAt: sql.NullInt64{Int64: 101, Valid: true}},
+	)
+	reportPath := func(livecommentID int64) string {
+		return livestreamPath(livestream.ID, "/livecomment/"+strconv.FormatInt(livecommentID, 10)+"/report")
+	}
+
+	rec := s.do(http.MethodPost, reportPath(1), nil, bobCookie)
+	expectStatus(t, rec, http.StatusCreated)
+	if report := decodeBody[LivecommentReport](t, rec); report.Reporter.ID != bob.ID || report.Livecomment.ID != 1 || report.Status != reportStatusOpen {
+		t.Errorf("report = %+v", report)
+	}
+
+	rec = s.do(http.MethodPost, reportPath(1), nil, bobCookie)
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = s.do(http.MethodPost, reportPath(2), nil, bobCookie)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = s.do(http.MethodGet, livestreamPath(livestream.ID, "/report"), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusOK)
+	if reports := decodeBody[[]LivecommentReport](t, rec); len(reports) != 1 {
+		t.Errorf("reports = %+v", reports)
+	}
+}
+
+func TestModerateHidesLivecomments(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	s.register("bob")
+	aliceCookie := s.login("alice")
+	bobCookie := s.login("bob")
+	livestream := s.reserve(aliceCookie, testReserveStartAt, nil)
+
+	for _, comment := range []string{"hello", "buy cheap pills"} {
+		rec := s.do(http.MethodPost, livestreamPath(livestream.ID, "/livecomment"), PostLivecommentRequest{Comment: comment}, bobCookie)
+		expectStatus(t, rec, http.StatusCreated)
+	}
+
+	// 全体NGワードの登録前に投稿されたライブコメント
+	s.store.InsertLivecomments(store.Livecomment{UserID: livestream.Owner.ID, LivestreamID: livestream.ID, Comment: "old scam", CreatedAt: 100})
+	s.store.InsertNGWords(store.NGWord{Word: "scam", Scope: "global", CreatedAt: 100})
+
+	// 既存のAPIなので、他の配信者の配信も存在しない配信も従来通り400
+	rec := s.do(http.MethodPost, livestreamPath(livestream.ID, "/moderate"), ModerateRequest{NGWord: "pills"}, bobCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID+1, "/moderate"), ModerateRequest{NGWord: "pills"}, aliceCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID, "/moderate"), ModerateRequest{NGWord: "pills"}, aliceCookie)
+	expectStatus(t, rec, http.StatusCreated)
+	wordID := decodeBody[map[string]int64](t, rec)["word_id"]
+
+	// NGワードの編集・削除APIでは、ほかのモデレーションAPIと同じく403と404
+	rec = s.do(http.MethodDelete, livestreamPath(livestream.ID, "/ngwords/"+strconv.FormatInt(wordID, 10)), nil, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = s.do(http.MethodDelete, livestreamPath(livestream.ID+1, "/ngwords/"+strconv.FormatInt(wordID, 10)), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	// 登録前に投稿されたライブコメントも非表示になるが、全体NGワードは過去の投稿に遡らない
+	rec = s.do(http.MethodGet, livestreamPath(livestream.ID, "/livecomment"), nil, bobCookie)
+	expectStatus(t, rec, http.StatusOK)
+	livecomments := decodeBody[[]Livecomment](t, rec)
+	var comments []string
+	for _, livecomment := range livecomments {
+		comments = append(comments, livecomment.Comment)
+	}
+	if len(comments) != 2 || !slices.Contains(comments, "hello") || !slices.Contains(comments, "old scam") {
+		t.Errorf("comments = %v, want [hello old scam]", comments)
+	}
+
+	// 以降の投稿はキャッシュ済みのMatcherで弾かれる
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID, "/livecomment"), PostLivecommentRequest{Comment: "more pills"}, bobCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestBanUser(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	bob := s.register("bob")
+	aliceCookie := s.login("alice")
+	bobCookie := s.login("bob")
+	livestream := s.reserve(aliceCookie, testReserveStartAt, nil)
+
+	rec := s.do(http.MethodPost, livestreamPath(livestream.ID, "/ban"), PostUserBanRequest{UserID: bob.ID, Reason: "spam"}, aliceCookie)
+	expectStatus(t, rec, http.StatusCreated)
+	ban := decodeBody[UserBan](t, rec)
+	if ban.User.ID != bob.ID || ban.Scope != banScopeLivestream || ban.ExpiresAt != nil {
+		t.Errorf("ban = %+v", ban)
+	}
+
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID, "/livecomment"), PostLivecommentRequest{Comment: "hello"}, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID, "/reaction"), PostReactionRequest{EmojiName: "tada"}, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID, "/enter"), nil, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	// BANを作成できるのは配信者とモデレーターのみ
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID, "/ban"), PostUserBanRequest{UserID: livestream.Owner.ID}, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = s.do(http.MethodDelete, livestreamPath(livestream.ID, "/ban/"+strconv.FormatInt(ban.ID, 10)), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = s.do(http.MethodPost, livestreamPath(livestream.ID, "/livecomment"), PostLivecommentRequest{Comment: "hello"}, bobCookie)
+	expectStatus(t, rec, http.StatusCreated)
+}
+
+func TestReservationSlots(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	cookie := s.login("alice")
+
+	const hour = 60 * 60
+	// 空き枠の検索は現在時刻以降を探すので、予約期間を現在に合わせる
+	base := time.Now().Add(24 * time.Hour).Truncate(time.Hour).Unix()
+	restoreReservationConfig(t)
+	reservationTermStartAt, reservationTermEndAt = time.Unix(base-48*hour, 0), time.Unix(base+24*hour, 0)
+	s.store.InsertReservationSlots(
+		// 開始済みの枠
+		store.ReservationSlot{Slot: 2, StartAt: base - 48*hour, EndAt: base - 47*hour},
+		store.ReservationSlot{Slot: 2, StartAt: base - 47*hour, EndAt: base - 46*hour},
+		store.ReservationSlot{Slot: 2, StartAt: base - 46*hour, EndAt: base - 45*hour},
+		store.ReservationSlot{Slot: 1, StartAt: base, EndAt: base + hour},
+		store.ReservationSlot{Slot: 0, StartAt: base + hour, EndAt: base + 2*hour},
+		store.ReservationSlot{Slot: 2, StartAt: base + 2*hour, EndAt: base + 3*hour},
+		store.ReservationSlot{Slot: 2, StartAt: base + 3*hour, EndAt: base + 4*hour},
+		// base+4h からの枠はない
+		store.ReservationSlot{Slot: 2, StartAt: base + 5*hour, EndAt: base + 6*hour},
+		store.ReservationSlot{Slot: 2, StartAt: base + 6*hour, EndAt: base + 7*hour},
+		store.ReservationSlot{Slot: 2, StartAt: base + 7*hour, EndAt: base + 8*hour},
+	)
+
+	t.Run("残数一覧", func(t *testing.T) {
+		rec := s.do(http.MethodGet, fmt.Sprintf("/api/reservation/slots?from=%d&to=%d", base, base+3*hour), nil, cookie)
+		expectStatus(t, rec, http.StatusOK)
+		slots := decodeBody[[]ReservationSlot](t, rec)
+		if len(slots) != 3 || slots[0].Remaining != 1 || slots[1].Remaining != 0 || slots[2].StartAt != base+2*hour {
+			t.Errorf("slots = %+v", slots)
+		}
+	})
+
+	t.Run("残数一覧の不正な範囲", func(t *testing.T) {
+		for _, query := range []string{
+			"",
+			fmt.Sprintf("?from=%d", base),
+			fmt.Sprintf("?from=%d&to=%d", base, base),
+			fmt.Sprintf("?from=%d&to=%d", base, base+32*24*hour),
+			"?from=a&to=b",
+		} {
+			rec := s.do(http.MethodGet, "/api/reservation/slots"+query, nil, cookie)
+			expectStatus(t, rec, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("空き枠の検索", func(t *testing.T) {
+		tests := []struct {
+			query string
+			want  ReservationWindow
+		}{
+			{query: "hours=1", want: ReservationWindow{StartAt: base, EndAt: base + hour}},
+			{query: "hours=2", want: ReservationWindow{StartAt: base + 2*hour, EndAt: base + 4*hour}},
+			{query: "hours=3", want: ReservationWindow{StartAt: base + 5*hour, EndAt: base + 8*hour}},
+			{query: fmt.Sprintf("hours=1&from=%d", base+3*hour), want: ReservationWindow{StartAt: base + 3*hour, EndAt: base + 4*hour}},
+			{query: fmt.Sprintf("hours=3&from=%d", base-48*hour), want: ReservationWindow{StartAt: base - 48*hour, EndAt: base - 45*hour}},
+		}
+		for _, tt := range tests {
+			rec := s.do(http.MethodGet, "/api/reservation/slots/available?"+tt.query, nil, cookie)
+			expectStatus(t, rec, http.StatusOK)
+			if got := decodeBody[ReservationWindow](t, rec); got != tt.want {
+				t.Errorf("%s: window = %+v, want %+v", tt.query, got, tt.want)
+			}
+		}
+
+		rec := s.do(http.MethodGet, "/api/reservation/slots/available?hours=4", nil, cookie)
+		expectStatus(t, rec, http.StatusNotFound)
+		rec = s.do(http.MethodGet, "/api/reservation/slots/available?hours=0", nil, cookie)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("ログインしていない", func(t *testing.T) {
+		rec := s.do(http.MethodGet, fmt.Sprintf("/api/reservation/slots?from=%d&to=%d", base, base+hour), nil, nil)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+}
+
+func TestReserveUnalignedRange(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	s.register("bob")
+	aliceCookie := s.login("alice")
+	bobCookie := s.login("bob")
+
+	const hour = 60 * 60
+	base := testReserveStartAt
+	s.store.InsertReservationSlots(
+		store.ReservationSlot{Slot: 1, StartAt: base, EndAt: base + hour},
+		store.ReservationSlot{Slot: 1, StartAt: base + hour, EndAt: base + 2*hour},
+	)
+
+	// 一部だけ重なる予約枠も消費する
+	rec := s.do(http.MethodPost, "/api/livestream/reservation", ReserveLivestreamRequest{Title: "unaligned", StartAt: base + 30*60, EndAt: base + 90*60}, aliceCookie)
+	expectStatus(t, rec, http.StatusCreated)
+	for _, r := range []ReserveLivestreamRequest{
+		{Title: "first", StartAt: base, EndAt: base + hour},
+		{Title: "second", StartAt: base + hour + 15*60, EndAt: base + hour + 45*60},
+	} {
+		rec = s.do(http.MethodPost, "/api/livestream/reservation", r, bobCookie)
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+
+	ctx := context.Background()
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	slots, err := tx.Reservations().ListSlots(ctx, base, base+2*hour)
+	if err != nil || len(slots) != 2 || slots[0].Slot != 0 || slots[1].Slot != 0 {
+		t.Errorf("slots = %+v, %v", slots, err)
+	}
+}
+
+func TestCancelLivestream(t *testing.T) {
+	s := newTestServer(t)
+	s.store.InsertTags("ライブ配信")
+	alice := s.register("alice")
+	bob := s.register("bob")
+	aliceCookie := s.login("alice")
+	bobCookie := s.login("bob")
+
+	// 予約期間は過去なので、開始前の配信は直接用意する
+	const hour = 60 * 60
+	startAt := time.Now().Add(24 * time.Hour).Truncate(time.Hour).Unix()
+	s.store.InsertReservationSlots(
+		store.ReservationSlot{Slot: 0, StartAt: startAt, EndAt: startAt + hour},
+		store.ReservationSlot{Slot: 2, StartAt: startAt + hour, EndAt: startAt + 2*hour},
+		store.ReservationSlot{Slot: 3, StartAt: startAt + 2*hour, EndAt: startAt + 3*hour},
+	)
+	s.store.InsertLivestreams(store.Livestream{ID: 1, UserID: alice.ID, Title: "future", StartAt: startAt, EndAt: startAt + 2*hour})
+	s.store.InsertLivestreamTags(store.LivestreamTag{LivestreamID: 1, TagID: 1})
+	s.store.InsertNGWords(
+		store.NGWord{UserID: alice.ID, LivestreamID: 1, Word: "配信", Scope: "livestream"},
+		store.NGWord{UserID: alice.ID, Word: "チャンネル", Scope: "channel"},
+	)
+	s.store.InsertLivecomments(store.Livecomment{ID: 1, UserID: bob.ID, LivestreamID: 1, Comment: "待機", CreatedAt: 100})
+	s.store.InsertReports(store.LivecommentReport{UserID: alice.ID, LivestreamID: 1, LivecommentID: 1, Status: "open", CreatedAt: 101})
+	s.store.InsertReactions(store.Reaction{UserID: bob.ID, LivestreamID: 1, EmojiName: "tada", CreatedAt: 102})
+	s.store.InsertViewers(store.LivestreamViewer{UserID: bob.ID, LivestreamID: 1, CreatedAt: 103})
+	s.store.InsertPins(store.LivestreamPin{LivestreamID: 1, LivecommentID: 1, PinnedBy: alice.ID, PinnedAt: 104})
+	s.store.InsertModerators(
+		store.Moderator{StreamerID: alice.ID, UserID: bob.ID, LivestreamID: 1, Scope: "livestream", Permissions: permissionBan},
+		store.Moderator{StreamerID: alice.ID, UserID: bob.ID, Scope: "channel", Permissions: permissionViewReports},
+	)
+	s.store.InsertBans(
+		store.UserBan{UserID: bob.ID, StreamerID: alice.ID, LivestreamID: 1, Scope: "livestream", CreatedBy: alice.ID},
+		store.UserBan{UserID: bob.ID, StreamerID: alice.ID, Scope: "channel", CreatedBy: alice.ID},
+	)
+	ctx := context.Background()
+	func() {
+		tx, err := s.store.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if err := tx.Moderation().UpsertLivestreamSettings(ctx, &store.LivestreamSettings{LivestreamID: 1, SlowModeSeconds: 10}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Moderation().CreateModerationLog(ctx, &store.ModerationLog{LivestreamID: 1, UserID: alice.ID, Action: "report_hidden", CreatedAt: 105}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	past := s.reserve(aliceCookie, testReserveStartAt, nil)
+
+	rec := s.do(http.MethodDelete, livestreamPath(1, ""), nil, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = s.do(http.MethodDelete, livestreamPath(past.ID, ""), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = s.do(http.MethodDelete, livestreamPath(1, ""), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = s.do(http.MethodDelete, livestreamPath(1, ""), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = s.do(http.MethodGet, livestreamPath(1, ""), nil, aliceCookie)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	slots, err := tx.Reservations().ListSlots(ctx, startAt, startAt+3*hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 3 || slots[0].Slot != 1 || slots[1].Slot != 3 || slots[2].Slot != 3 {
+		t.Errorf("slots = %+v, want remaining 1, 3, 3", slots)
+	}
+	if livestreamTags, err := tx.Livestreams().GetLivestreamTagsByLivestreamIDs(ctx, []int64{1}); err != nil || len(livestreamTags) != 0 {
+		t.Errorf("livestream tags = %+v, %v", livestreamTags, err)
+	}
+	ngWords, err := tx.Moderation().ListNGWords(ctx, alice.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ngWords) != 1 || ngWords[0].Scope != "channel" {
+		t.Errorf("ng words = %+v, want only the channel word", ngWords)
+	}
+
+	t.Run("配信に紐づくデータも削除する", func(t *testing.T) {
+		if livecomments, err := tx.Livecomments().ListLivecomments(ctx, 1); err != nil || len(livecomments) != 0 {
+			t.Errorf("livecomments = %+v, %v", livecomments, err)
+		}
+		if reports, err := tx.Livecomments().ListReports(ctx, 1, ""); err != nil || len(reports) != 0 {
+			t.Errorf("reports = %+v, %v", reports, err)
+		}
+		if pins, err := tx.Livecomments().GetPinsByLivestreamIDs(ctx, []int64{1}); err != nil || len(pins) != 0 {
+			t.Errorf("pins = %+v, %v", pins, err)
+		}
+		if count, err := tx.Reactions().CountReactions(ctx, 1); err != nil || count != 0 {
+			t.Errorf("reactions = %d, %v", count, err)
+		}
+		if count, err := tx.Livestreams().CountViewers(ctx, 1); err != nil || count != 0 {
+			t.Errorf("viewers = %d, %v", count, err)
+		}
+		if _, err := tx.Moderation().GetLivestreamSettings(ctx, 1); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("settings err = %v, want ErrNotFound", err)
+		}
+		if logs, err := tx.Moderation().ListModerationLogs(ctx, 1); err != nil || len(logs) != 0 {
+			t.Errorf("moderation logs = %+v, %v", logs, err)
+		}
+	})
+
+	t.Run("チャンネルのモデレーターとBANは残す", func(t *testing.T) {
+		moderators, err := tx.Moderation().ListModerators(ctx, alice.ID, 1)
+		if err != nil || len(moderators) != 1 || moderators[0].Scope != "channel" {
+			t.Errorf("moderators = %+v, %v", moderators, err)
+		}
+		bans, err := tx.Moderation().ListActiveBans(ctx, alice.ID, 1, time.Now().Unix())
+		if err != nil || len(bans) != 1 || bans[0].Scope != "channel" {
+			t.Errorf("bans = %+v, %v", bans, err)
+		}
+	})
+}
+
+func TestPatchLivestream(t *testing.T) {
+	s := newTestServer(t)
+	s.store.InsertTags("ライブ配信", "ゲーム実況")
+	alice := s.register("alice")
+	s.register("bob")
+	aliceCookie := s.login("alice")
+	bobCookie := s.login("bob")
+
+	const hour = 60 * 60
+	startAt := time.Now().Add(24 * time.Hour).Truncate(time.Hour).Unix()
+	restoreReservationConfig(t)
+	reservationTermStartAt, reservationTermEndAt = time.Unix(startAt, 0), time.Unix(startAt+4*hour, 0)
+
+	s.store.InsertReservationSlots(
+		store.ReservationSlot{Slot: 0, StartAt: startAt, EndAt: startAt + hour},
+		store.ReservationSlot{Slot: 1, StartAt: startAt + hour, EndAt: startAt + 2*hour},
+		store.ReservationSlot{Slot: 1, StartAt: startAt + 2*hour, EndAt: startAt + 3*hour},
+		store.ReservationSlot{Slot: 0, StartAt: startAt + 3*hour, EndAt: startAt + 4*hour},
+	)
+	s.store.InsertLivestreams(store.Livestream{ID: 1, UserID: alice.ID, Title: "future", StartAt: startAt, EndAt: startAt + hour})
+	s.store.InsertLivestreamTags(store.LivestreamTag{LivestreamID: 1, TagID: 1})
+
+	title := "renamed"
+	rec := s.do(http.MethodPatch, livestreamPath(1, ""), PatchLivestreamRequest{Title: &title}, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	tags := []int64{2}
+	rec = s.do(http.MethodPatch, livestreamPath(1, ""), PatchLivestreamRequest{Title: &title, Tags: &tags}, aliceCookie)
+	expectStatus(t, rec, http.StatusOK)
+	livestream := decodeBody[Livestream](t, rec)
+	if livestream.Title != "renamed" || livestream.StartAt != startAt {
+		t.Errorf("livestream = %+v", livestream)
+	}
+	if len(livestream.Tags) != 1 || livestream.Tags[0].Name != "ゲーム実況" {
+		t.Errorf("tags = %+v, want only ゲーム実況", livestream.Tags)
+	}
+
+	// 変更前の区間と重なる区間にも変更できる
+	newStartAt, newEndAt := startAt+hour, startAt+3*hour
+	rec = s.do(http.MethodPatch, livestreamPath(1, ""), PatchLivestreamRequest{StartAt: &newStartAt, EndAt: &newEndAt}, aliceCookie)
+	expectStatus(t, rec, http.StatusOK)
+	if livestream := decodeBody[Livestream](t, rec); livestream.StartAt != newStartAt || livestream.EndAt != newEndAt {
+		t.Errorf("livestream = %+v, want %d ~ %d", livestream, newStartAt, newEndAt)
+	}
+
+	fullEndAt := startAt + 4*hour
+	rec = s.do(http.MethodPatch, livestreamPath(1, ""), PatchLivestreamRequest{EndAt: &fullEndAt}, aliceCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+	invalidEndAt := newStartAt
+	rec = s.do(http.MethodPatch, livestreamPath(1, ""), PatchLivestreamRequest{EndAt: &invalidEndAt}, aliceCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	ctx := context.Background()
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	slots, err := tx.Reservations().ListSlots(ctx, startAt, startAt+4*hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 4 || slots[0].Slot != 1 || slots[1].Slot != 0 || slots[2].Slot != 0 || slots[3].Slot != 0 {
+		t.Errorf("slots = %+v, want remaining 1, 0, 0, 0", slots)
+	}
+}
+
+// TestPatchAndCancelLivestream 取り消しのトランザクションの開始後に予約区間の変更がコミットされても、変更後の区間の予約枠を戻す
+func TestPatchAndCancelLivestream(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.register("alice")
+	aliceCookie := s.login("alice")
+
+	const hour = 60 * 60
+	startAt := time.Now().Add(24 * time.Hour).Truncate(time.Hour).Unix()
+	restoreReservationConfig(t)
+	reservationTermStartAt, reservationTermEndAt = time.Unix(startAt, 0), time.Unix(startAt+2*hour, 0)
+
+	s.store.InsertReservationSlots(
+		store.ReservationSlot{Slot: 0, StartAt: startAt, EndAt: startAt + hour},
+		store.ReservationSlot{Slot: 1, StartAt: startAt + hour, EndAt: startAt + 2*hour},
+	)
+	s.store.InsertLivestreams(store.Livestream{ID: 1, UserID: alice.ID, Title: "future", StartAt: startAt, EndAt: startAt + hour})
+
+	ctx := context.Background()
+	cancelTx, err := s.store.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancelTx.Rollback()
+
+	newStartAt, newEndAt := startAt+hour, startAt+2*hour
+	rec := s.do(http.MethodPatch, livestreamPath(1, ""), PatchLivestreamRequest{StartAt: &newStartAt, EndAt: &newEndAt}, aliceCookie)
+	expectStatus(t, rec, http.StatusOK)
+
+	livestreamModel, err := cancelTx.Livestreams().GetLivestreamByIDForUpdate(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if livestreamModel.StartAt != newStartAt {
+		t.Fatalf("locked livestream = %+v, want the rescheduled one", livestreamModel)
+	}
+	if deleted, err := cancelLivestream(ctx, cancelTx, livestreamModel); err != nil || !deleted {
+		t.Fatalf("cancelLivestream = %v, %v", deleted, err)
+	}
+	if err := cancelTx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	slots, err := tx.Reservations().ListSlots(ctx, startAt, startAt+2*hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 2 || slots[0].Slot != 1 || slots[1].Slot != 1 {
+		t.Errorf("slots = %+v, want remaining 1, 1", slots)
+	}
+}
+
+// restoreReservationConfig テストで書き換えた予約の設定を元に戻す
+func restoreReservationConfig(t *testing.T) {
+	termStartAt, termEndAt := reservationTermStartAt, reservationTermEndAt
+	slotDuration, slotCapacity := reservationSlotDuration, reservationSlotCapacity
+	t.Cleanup(func() {
+		reservationTermStartAt, reservationTermEndAt = termStartAt, termEndAt
+		reservationSlotDuration, reservationSlotCapacity = slotDuration, slotCapacity
+	})
+}
+
+func TestLoadReservationConfig(t *testing.T) {
+	restoreReservationConfig(t)
+
+	t.Setenv(reservationTermStartAtEnvKey, "2025-01-01T00:00:00Z")
+	t.Setenv(reservationTermEndAtEnvKey, "2026-01-01T00:00:00Z")
+	t.Setenv(reservationSlotMinutesEnvKey, "30")
+	t.Setenv(reservationSlotCapacityEnvKey, "3")
+	if err := loadReservationConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if !reservationTermStartAt.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) || !reservationTermEndAt.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("term = %s ~ %s", reservationTermStartAt, reservationTermEndAt)
+	}
+	if reservationSlotDuration != 30*time.Minute || reservationSlotCapacity != 3 {
+		t.Errorf("slot duration = %s, capacity = %d", reservationSlotDuration, reservationSlotCapacity)
+	}
+
+	origin := reservationTermStartAt.Unix()
+	if got := nextReservationSlotStartAt(origin + 15*60); got != origin+30*60 {
+		t.Errorf("next slot start = %d, want %d", got, origin+30*60)
+	}
+	if got := nextReservationSlotStartAt(origin - 60); got != origin {
+		t.Errorf("next slot start before term = %d, want %d", got, origin)
+	}
+
+	t.Setenv(reservationTermEndAtEnvKey, "2024-01-01T00:00:00Z")
+	if err := loadReservationConfig(); err == nil {
+		t.Error("term that ends before it starts is accepted")
+	}
+	t.Setenv(reservationTermEndAtEnvKey, "2026-01-01T00:00:00Z")
+	t.Setenv(reservationSlotCapacityEnvKey, "0")
+	if err := loadReservationConfig(); err == nil {
+		t.Error("zero capacity is accepted")
+	}
+}
+
+func TestLoadRateLimitConfig(t *testing.T) {
+	limiter := livecommentRateLimiter
+	t.Cleanup(func() { livecommentRateLimiter = limiter })
+
+	t.Setenv(livecommentRateLimitEnabledEnvKey, "false")
+	t.Setenv(livecommentRateLimitRateEnvKey, "0.5")
+	t.Setenv(livecommentRateLimitBurstEnvKey, "10")
+	if err := loadRateLimitConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if livecommentRateLimiter.enabled || livecommentRateLimiter.rate != 0.5 || livecommentRateLimiter.burst != 10 {
+		t.Errorf("limiter = %+v", livecommentRateLimiter)
+	}
+	// 無効ならRedisに問い合わせずに取り出せる
+	if ok, _, err := livecommentRateLimiter.take(context.Background(), 1); !ok || err != nil {
+		t.Errorf("take() = %v, %v", ok, err)
+	}
+
+	t.Setenv(livecommentRateLimitRateEnvKey, "0")
+	if err := loadRateLimitConfig(); err == nil {
+		t.Error("zero rate is accepted")
+	}
+	t.Setenv(livecommentRateLimitRateEnvKey, "1")
+	t.Setenv(livecommentRateLimitBurstEnvKey, "many")
+	if err := loadRateLimitConfig(); err == nil {
+		t.Error("non-integer burst is accepted")
+	}
+}
+
+func TestExtendReservationSlots(t *testing.T) {
+	restoreReservationConfig(t)
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	reservationTermStartAt = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	reservationSlotDuration, reservationSlotCapacity = 30*time.Minute, 3
+
+	// 予約枠がなければ予約可能な期間の開始から作る
+	slots, err := extendReservationSlots(ctx, s.store, reservationTermStartAt.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 4 || slots[0].StartAt != reservationTermStartAt.Unix() || slots[3].Slot != 3 {
+		t.Errorf("slots = %+v, want 4 slots from term start", slots)
+	}
+
+	// 最後の予約枠から続けて作り、区切りに満たない端数は作らない
+	until := reservationTermStartAt.Add(3*time.Hour + 10*time.Minute)
+	slots, err = extendReservationSlots(ctx, s.store, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 2 || slots[0].StartAt != reservationTermStartAt.Add(2*time.Hour).Unix() {
+		t.Errorf("slots = %+v, want 2 slots from the last slot", slots)
+	}
+	if slots, err := extendReservationSlots(ctx, s.store, until); err != nil || len(slots) != 0 {
+		t.Errorf("slots = %+v, %v, want no new slots", slots, err)
+	}
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	all, err := tx.Reservations().ListSlots(ctx, reservationTermStartAt.Unix(), until.Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 6 {
+		t.Errorf("len(slots) = %d, want 6", len(all))
+	}
+}
+
+func TestReserveLivestreamSeries(t *testing.T) {
+	restoreReservationConfig(t)
+	s := newTestServer(t)
+	s.store.InsertTags("ライブ配信")
+	s.register("alice")
+	s.register("bob")
+	aliceCookie := s.login("alice")
+	bobCookie := s.login("bob")
+
+	const (
+		hour = 60 * 60
+		week = 7 * 24 * hour
+	)
+	startAt := time.Now().Add(24 * time.Hour).Truncate(time.Hour).Unix()
+	reservationTermStartAt, reservationTermEndAt = time.Unix(startAt, 0), time.Unix(startAt+3*week, 0)
+	s.store.InsertReservationSlots(
+		store.ReservationSlot{Slot: 1, StartAt: startAt, EndAt: startAt + hour},
+		store.ReservationSlot{Slot: 0, StartAt: startAt + week, EndAt: startAt + week + hour},
+		store.ReservationSlot{Slot: 1, StartAt: startAt + 2*week, EndAt: startAt + 2*week + hour},
+	)
+
+	req := ReserveLivestreamRequest{
+		Tags:       []int64{1},
+		Title:      "weekly",
+		StartAt:    startAt,
+		EndAt:      startAt + hour,
+		Recurrence: &Recurrence{Frequency: recurrenceWeekly, Count: 3},
+	}
+	rec := s.do(http.MethodPost, "/api/livestream/reservation", req, aliceCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+	res := decodeBody[ReserveLivestreamSeriesResponse](t, rec)
+	if res.SeriesID != 0 || len(res.Instances) != 3 {
+		t.Fatalf("response = %+v, want 3 instances without series", res)
+	}
+	for i, instance := range res.Instances {
+		if instance.Reserved || instance.Error == "" || instance.StartAt != startAt+int64(i)*week {
+			t.Errorf("instances[%d] = %+v, want not reserved", i, instance)
+		}
+	}
+
+	req.Recurrence = &Recurrence{Frequency: recurrenceWeekly, Until: startAt + 2*week, Mode: recurrenceModeBestEffort}
+	rec = s.do(http.MethodPost, "/api/livestream/reservation", req, aliceCookie)
+	expectStatus(t, rec, http.StatusCreated)
+	res = decodeBody[ReserveLivestreamSeriesResponse](t, rec)
+	if res.SeriesID == 0 || len(res.Instances) != 3 {
+		t.Fatalf("response = %+v, want 3 instances in a series", res)
+	}
+	if !res.Instances[0].Reserved || res.Instances[1].Reserved || !res.Instances[2].Reserved {
+		t.Errorf("instances = %+v, want only the second one to fail", res.Instances)
+	}
+	first := res.Instances[0].Livestream
+	if first == nil || first.SeriesID != res.SeriesID || len(first.Tags) != 1 {
+		t.Errorf("livestream = %+v, want it in series %d with tags", first, res.SeriesID)
+	}
+
+	req.Recurrence = &Recurrence{Frequency: "monthly", Count: 2}
+	rec = s.do(http.MethodPost, "/api/livestream/reservation", req, aliceCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+	req.Recurrence = &Recurrence{Frequency: recurrenceDaily, Count: maxRecurrenceInstances + 1}
+	rec = s.do(http.MethodPost, "/api/livestream/reservation", req, aliceCookie)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	seriesPath := fmt.Sprintf("/api/livestream/series/%d", res.SeriesID)
+	rec = s.do(http.MethodDelete, seriesPath, nil, bobCookie)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = s.do(http.MethodDelete, seriesPath, nil, aliceCookie)
+	expectStatus(t, rec, http.StatusOK)
+	cancelled := decodeBody[CancelLivestreamSeriesResponse](t, rec)
+	if len(cancelled.CancelledLivestreamIDs) != 2 {
+		t.Errorf("cancelled = %+v, want 2 livestreams", cancelled)
+	}
+	rec = s.do(http.MethodDelete, "/api/livestream/series/999", nil, aliceCookie)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	ctx := context.Background()
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	slots, err := tx.Reservations().ListSlots(ctx, startAt, startAt+3*week)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 3 || slots[0].Slot != 1 || slots[1].Slot != 0 || slots[2].Slot != 1 {
+		t.Errorf("slots = %+v, want remaining 1, 0, 1", slots)
+	}
+}
@@ -0,0 +1,243 @@
+// Package migrate バイナリに埋め込んだSQLでスキーマを管理する.
+// sql/ 以下に NNNN_名前.up.sql と NNNN_名前.down.sql の組で置き、
+// 適用済みのバージョンは schema_migrations テーブルに記録する
+package migrate
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/isucon/isucon13/webapp/go/sqlfile"
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockName 複数のアプリケーションサーバから同時に適用しないためのロック
+const lockName = "isupipe_schema_migrations"
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT NOT NULL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  applied_at BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin`
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status マイグレーションごとの適用状況
+type Status struct {
+	Migration
+	// AppliedAt 未適用なら0
+	AppliedAt int64
+}
+
+// Load 埋め込まれたマイグレーションをバージョン順に返す
+func Load() ([]Migration, error) {
+	return load(files, "sql")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := cutDirection(entry.Name())
+		if !ok {
+			return nil, fmt.Errorf("migration %s must end with .up.sql or .down.sql", entry.Name())
+		}
+		v, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s must be named NNNN_name", entry.Name())
+		}
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has invalid version: %w", entry.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up.sql", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func cutDirection(filename string) (string, string, bool) {
+	if base, ok := strings.CutSuffix(filename, ".up.sql"); ok {
+		return base, "up", true
+	}
+	if base, ok := strings.CutSuffix(filename, ".down.sql"); ok {
+		return base, "down", true
+	}
+	return "", "", false
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+func New(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// withLock GET_LOCKは接続ごとのロックなので、専用の接続で処理する
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked int
+	if err := conn.GetContext(ctx, &locked, "SELECT GET_LOCK(?, 60)", lockName); err != nil {
+		return fmt.Errorf("failed to get lock: %w", err)
+	}
+	if locked != 1 {
+		return fmt.Errorf("failed to get lock: timed out")
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+
+	if _, err := conn.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) (map[int64]int64, error) {
+	var rows []struct {
+		Version   int64 `db:"version"`
+		AppliedAt int64 `db:"applied_at"`
+	}
+	if err := conn.SelectContext(ctx, &rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, fmt.Errorf("failed to get schema_migrations: %w", err)
+	}
+	applied := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// exec DDLは暗黙にコミットされるため、途中で失敗した場合は記録せずに止める.
+// 各マイグレーションは再実行しても失敗しないように書くこと
+func exec(ctx context.Context, conn *sqlx.Conn, m Migration, body string) error {
+	for _, statement := range sqlfile.Split(body) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w\n%s", m.Version, m.Name, err, statement)
+		}
+	}
+	return nil
+}
+
+// Up 未適用のマイグレーションを全て適用し、適用したものを返す
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := exec(ctx, conn, migration, migration.Up); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", migration.Version, migration.Name, time.Now().Unix()); err != nil {
+				return fmt.Errorf("failed to record migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 適用済みのマイグレーションを新しいものから steps 個戻し、戻したものを返す
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := exec(ctx, conn, migration, migration.Down); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+				return fmt.Errorf("failed to record migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status 全てのマイグレーションの適用状況をバージョン順に返す
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			statuses = append(statuses, Status{Migration: migration, AppliedAt: applied[migration.Version]})
+		}
+		return nil
+	})
+	return statuses, err
+}
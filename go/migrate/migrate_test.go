@@ -0,0 +1,52 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/isucon/isucon13/webapp/go/sqlfile"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if len(sqlfile.Split(m.Up)) == 0 {
+			t.Errorf("migration %04d_%s has no up statements", m.Version, m.Name)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %04d_%s has no down.sql", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{name: "向きがない", files: fstest.MapFS{"sql/0001_init.sql": {}}},
+		{name: "名前がない", files: fstest.MapFS{"sql/0001.up.sql": {}}},
+		{name: "バージョンが数字でない", files: fstest.MapFS{"sql/abc_init.up.sql": {}}},
+		{name: "バージョンの重複", files: fstest.MapFS{
+			"sql/0001_a.up.sql": {Data: []byte("SELECT 1;")},
+			"sql/0001_b.up.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{name: "upがない", files: fstest.MapFS{"sql/0001_init.down.sql": {Data: []byte("SELECT 1;")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := load(tt.files, "sql"); err == nil {
+				t.Error("load() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS `reactions`;
+DROP TABLE IF EXISTS `ng_words`;
+DROP TABLE IF EXISTS `user_bans`;
+DROP TABLE IF EXISTS `livestream_pins`;
+DROP TABLE IF EXISTS `livestream_settings`;
+DROP TABLE IF EXISTS `moderators`;
+DROP TABLE IF EXISTS `livecomment_reports`;
+DROP TABLE IF EXISTS `moderation_logs`;
+DROP TABLE IF EXISTS `livecomments`;
+DROP TABLE IF EXISTS `livestream_viewers_history`;
+DROP TABLE IF EXISTS `livestream_tags`;
+DROP TABLE IF EXISTS `tags`;
+DROP TABLE IF EXISTS `reservation_slots`;
+DROP TABLE IF EXISTS `livestreams`;
+DROP TABLE IF EXISTS `themes`;
+DROP TABLE IF EXISTS `icons`;
+DROP TABLE IF EXISTS `users`;
@@ -0,0 +1,192 @@
+-- 初期スキーマ. initdb.d/10_schema.sqlで作成済みの環境でも適用できるようIF NOT EXISTSを付けている
+
+-- ユーザ (配信者、視聴者)
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `name` VARCHAR(255) NOT NULL,
+  `display_name` VARCHAR(255) NOT NULL,
+  `password` VARCHAR(255) NOT NULL,
+  `description` TEXT NOT NULL,
+  UNIQUE `uniq_user_name` (`name`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- プロフィール画像
+CREATE TABLE IF NOT EXISTS `icons` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `image` LONGBLOB NOT NULL,
+  `image_path` varchar(1000) NOT NULL,
+  `image_hash` varchar(1000) NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ユーザごとのカスタムテーマ
+CREATE TABLE IF NOT EXISTS `themes` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `dark_mode` BOOLEAN NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ライブ配信
+CREATE TABLE IF NOT EXISTS `livestreams` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `title` VARCHAR(255) NOT NULL,
+  `description` text NOT NULL,
+  `playlist_url` VARCHAR(255) NOT NULL,
+  `thumbnail_url` VARCHAR(255) NOT NULL,
+  `start_at` BIGINT NOT NULL,
+  `end_at` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ライブ配信予約枠
+CREATE TABLE IF NOT EXISTS `reservation_slots` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `slot` BIGINT NOT NULL,
+  `start_at` BIGINT NOT NULL,
+  `end_at` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ライブストリームに付与される、サービスで定義されたタグ
+CREATE TABLE IF NOT EXISTS `tags` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `name` VARCHAR(255) NOT NULL,
+  UNIQUE `uniq_tag_name` (`name`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ライブ配信とタグの中間テーブル
+CREATE TABLE IF NOT EXISTS `livestream_tags` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `livestream_id` BIGINT NOT NULL,
+  `tag_id` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ライブ配信視聴履歴
+CREATE TABLE IF NOT EXISTS `livestream_viewers_history` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `livestream_id` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ライブ配信に対するライブコメント
+CREATE TABLE IF NOT EXISTS `livecomments` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `livestream_id` BIGINT NOT NULL,
+  `comment` VARCHAR(255) NOT NULL,
+  `tip` BIGINT NOT NULL DEFAULT 0,
+  `created_at` BIGINT NOT NULL,
+  -- モデレーションで非表示になった場合に設定される. チップは売上として集計され続ける
+  `hidden_at` BIGINT NULL,
+  -- ng_word, report, report_threshold, author_deleted
+  `hidden_reason` VARCHAR(32) NULL,
+  `hidden_ng_word_id` BIGINT NULL,
+  -- 非表示を取り消した後も残る
+  `moderation_log_id` BIGINT NULL,
+  -- 投稿者が編集した日時
+  `edited_at` BIGINT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- 配信者によるモデレーションの履歴
+CREATE TABLE IF NOT EXISTS `moderation_logs` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `livestream_id` BIGINT NOT NULL,
+  -- 操作したユーザ
+  `user_id` BIGINT NOT NULL,
+  `ng_word_id` BIGINT NULL,
+  -- ng_word_added, ng_word_updated, report_hidden, report_threshold_hidden
+  `action` VARCHAR(32) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  `reverted_at` BIGINT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ユーザからのライブコメントのスパム報告
+CREATE TABLE IF NOT EXISTS `livecomment_reports` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `livestream_id` BIGINT NOT NULL,
+  `livecomment_id` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  -- open, dismissed, actioned
+  `status` VARCHAR(16) NOT NULL DEFAULT 'open',
+  -- dismiss, hide_comment, add_ng_word, ban_user
+  `action` VARCHAR(32) NULL,
+  `resolved_by` BIGINT NULL,
+  `resolved_at` BIGINT NULL,
+  UNIQUE `uniq_livecomment_reporter` (`livecomment_id`, `user_id`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- 配信者が任命したモデレーター
+CREATE TABLE IF NOT EXISTS `moderators` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  -- 任命した配信者
+  `streamer_id` BIGINT NOT NULL,
+  -- モデレーターに任命されたユーザ
+  `user_id` BIGINT NOT NULL,
+  -- channelの場合は0
+  `livestream_id` BIGINT NOT NULL,
+  -- livestream: 配信のみ, channel: 配信者の全配信
+  `scope` VARCHAR(16) NOT NULL DEFAULT 'livestream',
+  -- manage_ng_words, view_reports, delete_comments, ban のカンマ区切り
+  `permissions` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  UNIQUE `uniq_moderator` (`streamer_id`, `user_id`, `livestream_id`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- 配信者による配信ごとのモデレーション設定
+CREATE TABLE IF NOT EXISTS `livestream_settings` (
+  `livestream_id` BIGINT NOT NULL PRIMARY KEY,
+  -- 未対応の報告がこの数に達したライブコメントを自動で非表示にする. 0なら無効
+  `auto_hide_report_threshold` INT NOT NULL DEFAULT 0,
+  -- 同じユーザがライブコメントを投稿できる最小間隔(秒). 0なら無効
+  `slow_mode_seconds` INT NOT NULL DEFAULT 0
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- 配信者が配信の上部に固定したライブコメント. 配信ごとに1つまで
+CREATE TABLE IF NOT EXISTS `livestream_pins` (
+  `livestream_id` BIGINT NOT NULL PRIMARY KEY,
+  `livecomment_id` BIGINT NOT NULL,
+  `pinned_by` BIGINT NOT NULL,
+  `pinned_at` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- 配信者によるユーザのBAN
+CREATE TABLE IF NOT EXISTS `user_bans` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  -- BANされたユーザ
+  `user_id` BIGINT NOT NULL,
+  -- BANした配信者
+  `streamer_id` BIGINT NOT NULL,
+  -- channelの場合は0
+  `livestream_id` BIGINT NOT NULL,
+  -- livestream: 配信のみ, channel: 配信者の全配信
+  `scope` VARCHAR(16) NOT NULL DEFAULT 'livestream',
+  `reason` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_by` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  -- タイムアウトの期限. NULLなら無期限
+  `expires_at` BIGINT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- 配信者からのNGワード登録
+CREATE TABLE IF NOT EXISTS `ng_words` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `livestream_id` BIGINT NOT NULL,
+  `word` VARCHAR(255) NOT NULL,
+  -- substring, word, regex
+  `match_mode` VARCHAR(16) NOT NULL DEFAULT 'substring',
+  -- livestream: 配信のみ, channel: 配信者の全配信, global: 運営による全配信共通
+  `scope` VARCHAR(16) NOT NULL DEFAULT 'livestream',
+  `created_at` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- ライブ配信に対するリアクション
+CREATE TABLE IF NOT EXISTS `reactions` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `livestream_id` BIGINT NOT NULL,
+  -- :innocent:, :tada:, etc...
+  `emoji_name` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
@@ -0,0 +1 @@
+-- 追加したカラムは0001のテーブル定義の一部なので、ここでは削除しない
@@ -0,0 +1,17 @@
+-- 10_schema.sqlの古い版で作成された環境に、後から追加したカラムを足す
+
+ALTER TABLE ng_words ADD COLUMN IF NOT EXISTS `match_mode` VARCHAR(16) NOT NULL DEFAULT 'substring' AFTER `word`;
+ALTER TABLE ng_words ADD COLUMN IF NOT EXISTS `scope` VARCHAR(16) NOT NULL DEFAULT 'livestream' AFTER `match_mode`;
+ALTER TABLE livecomments ADD COLUMN IF NOT EXISTS `hidden_at` BIGINT NULL;
+ALTER TABLE livecomments ADD COLUMN IF NOT EXISTS `hidden_reason` VARCHAR(32) NULL;
+ALTER TABLE livecomments ADD COLUMN IF NOT EXISTS `hidden_ng_word_id` BIGINT NULL;
+ALTER TABLE livecomments ADD COLUMN IF NOT EXISTS `moderation_log_id` BIGINT NULL;
+ALTER TABLE livecomment_reports ADD COLUMN IF NOT EXISTS `status` VARCHAR(16) NOT NULL DEFAULT 'open';
+ALTER TABLE livecomment_reports ADD COLUMN IF NOT EXISTS `action` VARCHAR(32) NULL;
+ALTER TABLE livecomment_reports ADD COLUMN IF NOT EXISTS `resolved_by` BIGINT NULL;
+ALTER TABLE livecomment_reports ADD COLUMN IF NOT EXISTS `resolved_at` BIGINT NULL;
+ALTER TABLE user_bans ADD COLUMN IF NOT EXISTS `streamer_id` BIGINT NOT NULL AFTER `user_id`;
+ALTER TABLE user_bans ADD COLUMN IF NOT EXISTS `scope` VARCHAR(16) NOT NULL DEFAULT 'livestream' AFTER `livestream_id`;
+ALTER TABLE user_bans ADD COLUMN IF NOT EXISTS `expires_at` BIGINT NULL;
+ALTER TABLE livestream_settings ADD COLUMN IF NOT EXISTS `slow_mode_seconds` INT NOT NULL DEFAULT 0;
+ALTER TABLE livecomments ADD COLUMN IF NOT EXISTS `edited_at` BIGINT NULL;
@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS reactions_livestream_id_created_at_id_idx ON reactions;
+DROP INDEX IF EXISTS livecomments_livestream_id_created_at_id_idx ON livecomments;
+DROP INDEX IF EXISTS reactions_livestream_id_idx ON reactions;
+DROP INDEX IF EXISTS livecomments_livecomment_id_idx ON livecomment_reports;
+DROP INDEX IF EXISTS resevation_slots_start_at_end_at_idx ON reservation_slots;
+DROP INDEX IF EXISTS user_bans_streamer_id_idx ON user_bans;
+DROP INDEX IF EXISTS user_bans_user_id_livestream_id_idx ON user_bans;
+DROP INDEX IF EXISTS livecomment_reports_livestream_id_status_idx ON livecomment_reports;
+DROP INDEX IF EXISTS moderation_logs_livestream_id_created_at_idx ON moderation_logs;
+DROP INDEX IF EXISTS livecomments_moderation_log_id_idx ON livecomments;
+DROP INDEX IF EXISTS ng_words_scope_user_id_idx ON ng_words;
+DROP INDEX IF EXISTS ng_words_user_id_livestream_id_idx ON ng_words;
+DROP INDEX IF EXISTS themes_user_id_idx ON themes;
+DROP INDEX IF EXISTS icons_user_id_idx ON icons;
+DROP INDEX IF EXISTS livestream_user_id_idx ON livestreams;
+DROP INDEX IF EXISTS livestream_tags_livestream_id_idx ON livestream_tags;
+DROP INDEX IF EXISTS ng_words_word ON ng_words;
@@ -0,0 +1,19 @@
+-- initdb.d/10_schema.sqlとisu.sqlで食い違っていたインデックスをまとめる
+
+CREATE INDEX IF NOT EXISTS ng_words_word ON ng_words (`word`);
+CREATE INDEX IF NOT EXISTS livestream_tags_livestream_id_idx ON livestream_tags (livestream_id);
+CREATE INDEX IF NOT EXISTS livestream_user_id_idx ON livestreams (user_id);
+CREATE INDEX IF NOT EXISTS icons_user_id_idx ON icons (user_id);
+CREATE INDEX IF NOT EXISTS themes_user_id_idx ON themes (user_id);
+CREATE INDEX IF NOT EXISTS ng_words_user_id_livestream_id_idx ON ng_words (user_id, livestream_id);
+CREATE INDEX IF NOT EXISTS ng_words_scope_user_id_idx ON ng_words (scope, user_id);
+CREATE INDEX IF NOT EXISTS livecomments_moderation_log_id_idx ON livecomments (moderation_log_id);
+CREATE INDEX IF NOT EXISTS moderation_logs_livestream_id_created_at_idx ON moderation_logs (livestream_id, created_at);
+CREATE INDEX IF NOT EXISTS livecomment_reports_livestream_id_status_idx ON livecomment_reports (livestream_id, status);
+CREATE INDEX IF NOT EXISTS user_bans_user_id_livestream_id_idx ON user_bans (user_id, livestream_id);
+CREATE INDEX IF NOT EXISTS user_bans_streamer_id_idx ON user_bans (streamer_id);
+CREATE INDEX IF NOT EXISTS resevation_slots_start_at_end_at_idx ON reservation_slots (start_at, end_at);
+CREATE INDEX IF NOT EXISTS livecomments_livecomment_id_idx ON livecomment_reports (livecomment_id);
+CREATE INDEX IF NOT EXISTS reactions_livestream_id_idx ON reactions (livestream_id);
+CREATE INDEX IF NOT EXISTS livecomments_livestream_id_created_at_id_idx ON livecomments (livestream_id, created_at, id);
+CREATE INDEX IF NOT EXISTS reactions_livestream_id_created_at_id_idx ON reactions (livestream_id, created_at, id);
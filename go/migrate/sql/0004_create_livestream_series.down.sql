@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS livestreams_series_id_idx ON livestreams;
+ALTER TABLE livestreams DROP COLUMN IF EXISTS `series_id`;
+DROP TABLE IF EXISTS `livestream_series`;
@@ -0,0 +1,12 @@
+-- 繰り返し予約でまとめて作成した配信のシリーズ
+
+CREATE TABLE IF NOT EXISTS `livestream_series` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  -- daily, weekly
+  `frequency` VARCHAR(16) NOT NULL,
+  `created_at` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+ALTER TABLE livestreams ADD COLUMN IF NOT EXISTS `series_id` BIGINT NULL;
+CREATE INDEX IF NOT EXISTS livestreams_series_id_idx ON livestreams (series_id);
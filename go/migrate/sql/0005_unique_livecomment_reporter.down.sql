@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uniq_livecomment_reporter ON livecomment_reports;
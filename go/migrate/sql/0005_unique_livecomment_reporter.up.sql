@@ -0,0 +1,7 @@
+-- 同じユーザが同じライブコメントを2回以上報告できないようにする.
+-- 同時に報告された場合に重複していた行は、最初の報告だけを残す
+
+DELETE r1 FROM livecomment_reports r1
+INNER JOIN livecomment_reports r2 ON r1.livecomment_id = r2.livecomment_id AND r1.user_id = r2.user_id AND r1.id > r2.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_livecomment_reporter ON livecomment_reports (livecomment_id, user_id);
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/isucon/isucon13/webapp/go/migrate"
+	echolog "github.com/labstack/gommon/log"
+)
+
+const migrateUsage = "usage: isupipe migrate up|down [steps]|status"
+
+// runMigrateCommand isupipe migrate サブコマンド. 終了コードを返す
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	conn, err := connectDB(echolog.New("migrate"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect db: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	migrator, err := migrate.New(conn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load migrations: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate up: %v\n", err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "steps must be a positive integer")
+				return 2
+			}
+		}
+		done, err := migrator.Down(ctx, steps)
+		for _, m := range done {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate down: %v\n", err)
+			return 1
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get migration status: %v\n", err)
+			return 1
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != 0 {
+				appliedAt = time.Unix(s.AppliedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, appliedAt)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,615 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/isucon/isucon13/webapp/go/ngword"
+	"github.com/isucon/isucon13/webapp/go/store"
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// モデレーション操作の種類
+	moderationActionNGWordAdded   = "ng_word_added"
+	moderationActionNGWordUpdated = "ng_word_updated"
+	moderationActionReportHidden  = "report_hidden"
+	// 報告数のしきい値による自動非表示. 操作したユーザはいない
+	moderationActionReportThresholdHidden = "report_threshold_hidden"
+
+	// ライブコメントが非表示になった理由
+	hiddenReasonNGWord = "ng_word"
+	hiddenReasonReport = "report"
+	// 報告数がしきい値に達した
+	hiddenReasonReportThreshold = "report_threshold"
+	// 投稿者自身による削除
+	hiddenReasonAuthorDeleted = "author_deleted"
+
+	// ライブコメント報告の状態
+	reportStatusOpen      = "open"
+	reportStatusDismissed = "dismissed"
+	reportStatusActioned  = "actioned"
+
+	// ライブコメント報告への対応
+	reportActionDismiss     = "dismiss"
+	reportActionHideComment = "hide_comment"
+	reportActionAddNGWord   = "add_ng_word"
+	reportActionBanUser     = "ban_user"
+)
+
+var reportActionPermissions = map[string]string{
+	reportActionHideComment: permissionDeleteComments,
+	reportActionAddNGWord:   permissionManageNGWords,
+	reportActionBanUser:     permissionBan,
+}
+
+type ModerationLogModel = store.ModerationLog
+
+// ModerationLog モデレーション操作と、それによって非表示になったライブコメント
+type ModerationLog struct {
+	ID           int64                  `json:"id"`
+	LivestreamID int64                  `json:"livestream_id"`
+	Moderator    *User                  `json:"moderator"`
+	NGWordID     *int64                 `json:"ng_word_id"`
+	Action       string                 `json:"action"`
+	Livecomments []ModeratedLivecomment `json:"livecomments"`
+	CreatedAt    int64                  `json:"created_at"`
+	RevertedAt   *int64                 `json:"reverted_at"`
+}
+
+type LivestreamSettingsModel = store.LivestreamSettings
+
+type LivestreamSettings struct {
+	AutoHideReportThreshold int64 `json:"auto_hide_report_threshold"`
+	SlowModeSeconds         int64 `json:"slow_mode_seconds"`
+}
+
+type ResolveLivecommentReportRequest struct {
+	// Action dismiss, hide_comment, add_ng_word, ban_user のいずれか
+	Action string `json:"action"`
+	// add_ng_word の場合に登録するNGワード
+	NGWord    string `json:"ng_word"`
+	MatchMode string `json:"match_mode"`
+	// ban_user の場合のBAN理由
+	Reason string `json:"reason"`
+}
+
+type ModeratedLivecomment struct {
+	Livecomment
+	Reason   string `json:"reason"`
+	NGWordID *int64 `json:"ng_word_id"`
+	// Hidden 取り消された場合はfalse
+	Hidden bool `json:"hidden"`
+}
+
+func getModerationLogsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "getModerationLogsHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if _, err := authorizeModeration(ctx, tx, int64(livestreamID), userID, permissionDeleteComments); err != nil {
+		return err
+	}
+
+	logModels, err := tx.Moderation().ListModerationLogs(ctx, int64(livestreamID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderation logs: "+err.Error())
+	}
+
+	logs := make([]ModerationLog, len(logModels))
+	for i := range logModels {
+		log, err := fillModerationLogResponse(ctx, tx, logModels[i])
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill moderation log: "+err.Error())
+		}
+		logs[i] = log
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, logs)
+}
+
+// revertModerationLogHandler モデレーション操作で非表示にしたライブコメントを再表示する.
+// NGワード自体は残るので、必要なら別途NGワードを削除すること
+func revertModerationLogHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "revertModerationLogHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	moderationLogID, err := strconv.Atoi(c.Param("moderation_log_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "moderation_log_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if _, err := authorizeModeration(ctx, tx, int64(livestreamID), userID, permissionDeleteComments); err != nil {
+		return err
+	}
+
+	// ログをロックすることで、同じ操作の取り消しが並列に行われないようにする
+	logModel, err := tx.Moderation().GetModerationLogForUpdate(ctx, int64(moderationLogID))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderation log: "+err.Error())
+	}
+	if err != nil || logModel.LivestreamID != int64(livestreamID) {
+		return echo.NewHTTPError(http.StatusNotFound, "moderation log not found")
+	}
+	if logModel.RevertedAt.Valid {
+		return echo.NewHTTPError(http.StatusConflict, "moderation log has already been reverted")
+	}
+
+	livecommentModels, err := tx.Livecomments().ListLivecommentsByModerationLogID(ctx, logModel.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
+	}
+	livecommentModels = slices.DeleteFunc(livecommentModels, func(livecommentModel LivecommentModel) bool {
+		return !livecommentModel.HiddenAt.Valid
+	})
+
+	// 理由とNGワードは監査のために残し、非表示だけを解除する
+	// moderation_log_idが残っているコメントは、以降のNGワード登録でも再び非表示にはしない
+	if err := tx.Livecomments().RestoreLivecommentsByModerationLogID(ctx, logModel.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to restore livecomments: "+err.Error())
+	}
+	logModel.RevertedAt = sql.NullInt64{Int64: time.Now().Unix(), Valid: true}
+	if err := tx.Moderation().RevertModerationLog(ctx, logModel.ID, logModel.RevertedAt.Int64); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update moderation log: "+err.Error())
+	}
+
+	restored, err := fillLivecommentResponses(ctx, tx, livecommentModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment: "+err.Error())
+	}
+
+	log, err := fillModerationLogResponse(ctx, tx, logModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill moderation log: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	for _, livecomment := range restored {
+		if err := publishLivecomment(ctx, livecomment); err != nil {
+			c.Logger().Warnf("failed to publish livecomment: %v", err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, log)
+}
+
+// resolveLivecommentReportHandler 報告に対応する.
+// 対応はライブコメントに対して行うので、同じライブコメントへの未対応の報告もまとめて解決する
+func resolveLivecommentReportHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "resolveLivecommentReportHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	reportID, err := strconv.Atoi(c.Param("report_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "report_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *ResolveLivecommentReportRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	livestreamModel, err := authorizeModeration(ctx, tx, int64(livestreamID), userID, permissionViewReports)
+	if err != nil {
+		return err
+	}
+	// 対応の内容ごとに必要な権限
+	if permission, ok := reportActionPermissions[req.Action]; ok {
+		if _, err := authorizeModeration(ctx, tx, int64(livestreamID), userID, permission); err != nil {
+			return err
+		}
+	}
+
+	reportModel, err := tx.Livecomments().GetReportForUpdate(ctx, int64(reportID))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment report: "+err.Error())
+	}
+	if err != nil || reportModel.LivestreamID != int64(livestreamID) {
+		return echo.NewHTTPError(http.StatusNotFound, "livecomment report not found")
+	}
+	if reportModel.Status != reportStatusOpen {
+		return echo.NewHTTPError(http.StatusConflict, "livecomment report has already been resolved")
+	}
+
+	livecommentModel, err := tx.Livecomments().GetLivecommentForUpdate(ctx, reportModel.LivecommentID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment: "+err.Error())
+	}
+
+	now := time.Now().Unix()
+	status := reportStatusActioned
+	hiddenLivecommentIDs := make(map[int64][]int64)
+	var addedNGWord *NGWord
+	restored := false
+	switch req.Action {
+	case reportActionDismiss:
+		status = reportStatusDismissed
+		// 確認待ちで自動非表示になっていたものは再表示する
+		if livecommentModel.HiddenAt.Valid && livecommentModel.HiddenReason.String == hiddenReasonReportThreshold {
+			if err := tx.Livecomments().RestoreLivecomment(ctx, livecommentModel.ID); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to restore livecomment: "+err.Error())
+			}
+			if err := tx.Moderation().RevertModerationLog(ctx, livecommentModel.ModerationLogID.Int64, now); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to update moderation log: "+err.Error())
+			}
+			restored = true
+		}
+	case reportActionHideComment:
+		if livecommentModel.HiddenAt.Valid {
+			break
+		}
+		logModel := &ModerationLogModel{
+			LivestreamID: int64(livestreamID),
+			UserID:       userID,
+			Action:       moderationActionReportHidden,
+			CreatedAt:    now,
+		}
+		if err := tx.Moderation().CreateModerationLog(ctx, logModel); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert moderation log: "+err.Error())
+		}
+		if err := tx.Livecomments().HideLivecomments(ctx, []int64{livecommentModel.ID}, now, hiddenReasonReport, sql.NullInt64{}, logModel.ID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to hide livecomment: "+err.Error())
+		}
+		hiddenLivecommentIDs[int64(livestreamID)] = []int64{livecommentModel.ID}
+	case reportActionAddNGWord:
+		matchMode, err := ngword.ParseMode(req.MatchMode)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := ngword.Validate(ngword.Word{Text: req.NGWord, Mode: matchMode}); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		addedNGWord = &NGWord{
+			UserID:       livestreamModel.UserID,
+			LivestreamID: int64(livestreamID),
+			Word:         req.NGWord,
+			MatchMode:    string(matchMode),
+			Scope:        ngwordScopeLivestream,
+			CreatedAt:    now,
+		}
+		if err := tx.Moderation().CreateNGWord(ctx, addedNGWord); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert new NG word: "+err.Error())
+		}
+		hiddenLivecommentIDs, err = hideLivecommentsForNGWord(ctx, tx, addedNGWord, moderationActionNGWordAdded, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to hide old livecomments that hit spams: "+err.Error())
+		}
+	case reportActionBanUser:
+		if livecommentModel.UserID == userID || livecommentModel.UserID == livestreamModel.UserID {
+			return echo.NewHTTPError(http.StatusBadRequest, "can't ban yourself or the streamer")
+		}
+		// 報告からのBANは配信単位で無期限
+		if err := tx.Moderation().CreateBan(ctx, &UserBanModel{
+			UserID:       livecommentModel.UserID,
+			StreamerID:   livestreamModel.UserID,
+			LivestreamID: int64(livestreamID),
+			Scope:        banScopeLivestream,
+			Reason:       req.Reason,
+			CreatedBy:    userID,
+			CreatedAt:    now,
+		}); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert ban: "+err.Error())
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "action must be dismiss, hide_comment, add_ng_word or ban_user")
+	}
+
+	if err := tx.Livecomments().ResolveReports(ctx, reportModel.LivecommentID, status, req.Action, userID, now); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update livecomment reports: "+err.Error())
+	}
+
+	reportModel, err = tx.Livecomments().GetReportByID(ctx, reportModel.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment report: "+err.Error())
+	}
+	report, err := fillLivecommentReportResponse(ctx, tx, reportModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment report: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	if restored {
+		if err := publishLivecomment(ctx, report.Livecomment); err != nil {
+			c.Logger().Warnf("failed to publish livecomment: %v", err)
+		}
+	}
+	if addedNGWord != nil {
+		invalidateNGWordMatcher(ctx, ngwordMatcherKey(addedNGWord))
+	}
+	publishHiddenLivecomments(ctx, hiddenLivecommentIDs)
+
+	return c.JSON(http.StatusOK, report)
+}
+
+func getModerationSettingsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "getModerationSettingsHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	settingsModel, err := getLivestreamSettings(ctx, tx, int64(livestreamID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream settings: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, LivestreamSettings{
+		AutoHideReportThreshold: settingsModel.AutoHideReportThreshold,
+		SlowModeSeconds:         settingsModel.SlowModeSeconds,
+	})
+}
+
+func putModerationSettingsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "putModerationSettingsHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *LivestreamSettings
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.AutoHideReportThreshold < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "auto_hide_report_threshold must not be negative")
+	}
+	if req.SlowModeSeconds < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "slow_mode_seconds must not be negative")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	settingsModel := LivestreamSettingsModel{
+		LivestreamID:            int64(livestreamID),
+		AutoHideReportThreshold: req.AutoHideReportThreshold,
+		SlowModeSeconds:         req.SlowModeSeconds,
+	}
+	if err := tx.Moderation().UpsertLivestreamSettings(ctx, &settingsModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update livestream settings: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, LivestreamSettings{
+		AutoHideReportThreshold: settingsModel.AutoHideReportThreshold,
+		SlowModeSeconds:         settingsModel.SlowModeSeconds,
+	})
+}
+
+func getLivestreamSettings(ctx context.Context, tx store.Tx, livestreamID int64) (LivestreamSettingsModel, error) {
+	settingsModel, err := tx.Moderation().GetLivestreamSettings(ctx, livestreamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LivestreamSettingsModel{LivestreamID: livestreamID}, nil
+	}
+	return settingsModel, err
+}
+
+// autoHideReportedLivecomment 未対応の報告数がしきい値に達していればライブコメントを非表示にする.
+// 既に非表示のもの、配信者が非表示を取り消したものは対象にしない
+func autoHideReportedLivecomment(ctx context.Context, tx store.Tx, livestreamID int64, livecommentID int64) (bool, error) {
+	settingsModel, err := getLivestreamSettings(ctx, tx, livestreamID)
+	if err != nil {
+		return false, err
+	}
+	if settingsModel.AutoHideReportThreshold <= 0 {
+		return false, nil
+	}
+
+	reportCount, err := tx.Livecomments().CountOpenReporters(ctx, livecommentID)
+	if err != nil {
+		return false, err
+	}
+	if reportCount < settingsModel.AutoHideReportThreshold {
+		return false, nil
+	}
+
+	livecommentModel, err := tx.Livecomments().GetLivecommentForUpdate(ctx, livecommentID)
+	if err != nil {
+		return false, err
+	}
+	if livecommentModel.HiddenAt.Valid || livecommentModel.ModerationLogID.Valid {
+		return false, nil
+	}
+
+	logModel := &ModerationLogModel{
+		LivestreamID: livestreamID,
+		Action:       moderationActionReportThresholdHidden,
+		CreatedAt:    time.Now().Unix(),
+	}
+	if err := tx.Moderation().CreateModerationLog(ctx, logModel); err != nil {
+		return false, err
+	}
+	// ライブコメントは削除せずに非表示にする. チップは売上として集計され続ける
+	if err := tx.Livecomments().HideLivecomments(ctx, []int64{livecommentID}, logModel.CreatedAt, hiddenReasonReportThreshold, sql.NullInt64{}, logModel.ID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func fillModerationLogResponse(ctx context.Context, tx store.Tx, logModel ModerationLogModel) (ModerationLog, error) {
+	trace.StartSpan(ctx, "fillModerationLogResponse")
+	defer trace.EndSpan(ctx, nil)
+
+	// 自動で行われた操作にはモデレーターがいない
+	var moderator *User
+	if logModel.UserID != 0 {
+		moderatorModel, err := tx.Users().GetUserByID(ctx, logModel.UserID)
+		if err != nil {
+			return ModerationLog{}, err
+		}
+		user, err := fillUserResponse(ctx, tx, moderatorModel)
+		if err != nil {
+			return ModerationLog{}, err
+		}
+		moderator = &user
+	}
+
+	livecommentModels, err := tx.Livecomments().ListLivecommentsByModerationLogID(ctx, logModel.ID)
+	if err != nil {
+		return ModerationLog{}, err
+	}
+	filled, err := fillLivecommentResponses(ctx, tx, livecommentModels)
+	if err != nil {
+		return ModerationLog{}, err
+	}
+	livecomments := make([]ModeratedLivecomment, len(livecommentModels))
+	for i := range livecommentModels {
+		livecomments[i] = ModeratedLivecomment{
+			Livecomment: filled[i],
+			Reason:      livecommentModels[i].HiddenReason.String,
+			NGWordID:    nullInt64Ptr(livecommentModels[i].HiddenNGWordID),
+			Hidden:      livecommentModels[i].HiddenAt.Valid,
+		}
+	}
+
+	log := ModerationLog{
+		ID:           logModel.ID,
+		LivestreamID: logModel.LivestreamID,
+		Moderator:    moderator,
+		NGWordID:     nullInt64Ptr(logModel.NGWordID),
+		Action:       logModel.Action,
+		Livecomments: livecomments,
+		CreatedAt:    logModel.CreatedAt,
+		RevertedAt:   nullInt64Ptr(logModel.RevertedAt),
+	}
+	return log, nil
+}
+
+func nullInt64Ptr(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/isucon/isucon13/webapp/go/store"
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// モデレーターに付与できる権限
+	permissionManageNGWords  = "manage_ng_words"
+	permissionViewReports    = "view_reports"
+	permissionDeleteComments = "delete_comments"
+	permissionBan            = "ban"
+
+	// モデレーターの任命範囲
+	moderatorScopeLivestream = "livestream"
+	moderatorScopeChannel    = "channel"
+)
+
+var moderatorPermissions = []string{
+	permissionManageNGWords,
+	permissionViewReports,
+	permissionDeleteComments,
+	permissionBan,
+}
+
+type ModeratorModel = store.Moderator
+
+type Moderator struct {
+	ID           int64    `json:"id"`
+	User         User     `json:"user"`
+	LivestreamID int64    `json:"livestream_id"`
+	Scope        string   `json:"scope"`
+	Permissions  []string `json:"permissions"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+type PostModeratorRequest struct {
+	UserID int64 `json:"user_id"`
+	// Scope livestream(デフォルト)なら配信のみ、channelなら配信者の全配信
+	Scope       string   `json:"scope"`
+	Permissions []string `json:"permissions"`
+}
+
+func getModeratorsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "getModeratorsHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	moderatorModels, err := tx.Moderation().ListModerators(ctx, userID, int64(livestreamID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+	}
+
+	moderators := make([]Moderator, len(moderatorModels))
+	for i := range moderatorModels {
+		moderator, err := fillModeratorResponse(ctx, tx, moderatorModels[i])
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill moderator: "+err.Error())
+		}
+		moderators[i] = moderator
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, moderators)
+}
+
+// postModeratorHandler モデレーターを任命する. 同じ範囲で任命済みなら権限を置き換える
+func postModeratorHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "postModeratorHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostModeratorRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.UserID == userID {
+		return echo.NewHTTPError(http.StatusBadRequest, "streamer already has all permissions")
+	}
+	if len(req.Permissions) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "permissions must not be empty")
+	}
+	for _, permission := range req.Permissions {
+		if !slices.Contains(moderatorPermissions, permission) {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown permission: "+permission)
+		}
+	}
+
+	moderatorModel := &ModeratorModel{
+		StreamerID:   userID,
+		UserID:       req.UserID,
+		LivestreamID: int64(livestreamID),
+		Scope:        moderatorScopeLivestream,
+		Permissions:  strings.Join(req.Permissions, ","),
+		CreatedAt:    time.Now().Unix(),
+	}
+	switch req.Scope {
+	case "", moderatorScopeLivestream:
+	case moderatorScopeChannel:
+		moderatorModel.LivestreamID = 0
+		moderatorModel.Scope = moderatorScopeChannel
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "scope must be livestream or channel")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Users().GetUserByID(ctx, req.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
+	}
+
+	if err := tx.Moderation().UpsertModerator(ctx, moderatorModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert moderator: "+err.Error())
+	}
+
+	moderator, err := fillModeratorResponse(ctx, tx, *moderatorModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill moderator: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, moderator)
+}
+
+func deleteModeratorHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "deleteModeratorHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	moderatorID, err := strconv.Atoi(c.Param("moderator_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "moderator_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	deleted, err := tx.Moderation().DeleteModerator(ctx, int64(moderatorID), userID, int64(livestreamID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete moderator: "+err.Error())
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "moderator not found")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// hasModerationPermission 配信者本人か、permissionを持つモデレーターであればtrueを返す.
+// livestreamIDが0の場合はチャンネル全体に対する操作として、チャンネルのモデレーターのみ許可する
+func hasModerationPermission(ctx context.Context, tx store.Tx, streamerID int64, livestreamID int64, userID int64, permission string) (bool, error) {
+	if userID == streamerID {
+		return true, nil
+	}
+
+	permissionsList, err := tx.Moderation().GetModeratorPermissions(ctx, streamerID, livestreamID, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, permissions := range permissionsList {
+		if slices.Contains(strings.Split(permissions, ","), permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isModerator 権限に関わらず、配信者本人かモデレーターであればtrueを返す
+func isModerator(ctx context.Context, tx store.Tx, streamerID int64, livestreamID int64, userID int64) (bool, error) {
+	if userID == streamerID {
+		return true, nil
+	}
+
+	permissionsList, err := tx.Moderation().GetModeratorPermissions(ctx, streamerID, livestreamID, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(permissionsList) > 0, nil
+}
+
+// authorizeModeration 配信に対するモデレーション操作を検証し、配信を返す
+func authorizeModeration(ctx context.Context, tx store.Tx, livestreamID int64, userID int64, permission string) (LivestreamModel, error) {
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, livestreamID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LivestreamModel{}, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return LivestreamModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+	allowed, err := hasModerationPermission(ctx, tx, livestreamModel.UserID, livestreamModel.ID, userID, permission)
+	if err != nil {
+		return LivestreamModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+	}
+	if !allowed {
+		return LivestreamModel{}, echo.NewHTTPError(http.StatusForbidden, "you don't have permission to "+permission)
+	}
+	return livestreamModel, nil
+}
+
+// authorizeChannelModeration 配信者の全配信に及ぶ操作を検証する
+func authorizeChannelModeration(ctx context.Context, tx store.Tx, streamerID int64, userID int64, permission string) error {
+	allowed, err := hasModerationPermission(ctx, tx, streamerID, 0, userID, permission)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+	}
+	if !allowed {
+		return echo.NewHTTPError(http.StatusForbidden, "you don't have channel-wide permission to "+permission)
+	}
+	return nil
+}
+
+// verifyLivestreamOwner 配信者本人のみに許可する操作であることを検証する
+func verifyLivestreamOwner(ctx context.Context, tx store.Tx, livestreamID int64, userID int64) error {
+	livestreamModel, err := tx.Livestreams().GetLivestreamByID(ctx, livestreamID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+	if livestreamModel.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "can't moderate other streamer's livestream")
+	}
+	return nil
+}
+
+func fillModeratorResponse(ctx context.Context, tx store.Tx, moderatorModel ModeratorModel) (Moderator, error) {
+	userModel, err := tx.Users().GetUserByID(ctx, moderatorModel.UserID)
+	if err != nil {
+		return Moderator{}, err
+	}
+	user, err := fillUserResponse(ctx, tx, userModel)
+	if err != nil {
+		return Moderator{}, err
+	}
+
+	moderator := Moderator{
+		ID:           moderatorModel.ID,
+		User:         user,
+		LivestreamID: moderatorModel.LivestreamID,
+		Scope:        moderatorModel.Scope,
+		Permissions:  strings.Split(moderatorModel.Permissions, ","),
+		CreatedAt:    moderatorModel.CreatedAt,
+	}
+	return moderator, nil
+}
@@ -0,0 +1,60 @@
+package ngword
+
+import "sync"
+
+// Cache キーごとに構築済みのMatcherを保持する.
+// NGワードが変更されたらInvalidateで破棄し、次回のGetで再構築する
+type Cache struct {
+	mu       sync.Mutex
+	matchers map[string]*Matcher
+	// 読み込み中に無効化された古い結果を保存しないための世代番号
+	generations map[string]uint64
+	epoch       uint64
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		matchers:    make(map[string]*Matcher),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Get キャッシュ済みのMatcherを返す. なければloadで読み込んで構築する
+func (c *Cache) Get(key string, load func() ([]Word, error)) (*Matcher, error) {
+	c.mu.Lock()
+	if m, ok := c.matchers[key]; ok {
+		c.mu.Unlock()
+		return m, nil
+	}
+	gen, epoch := c.generations[key], c.epoch
+	c.mu.Unlock()
+
+	words, err := load()
+	if err != nil {
+		return nil, err
+	}
+	m := New(words)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations[key] == gen && c.epoch == epoch {
+		c.matchers[key] = m
+	}
+	return m, nil
+}
+
+// Invalidate keyのMatcherを破棄する
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.matchers, key)
+	c.generations[key]++
+}
+
+// Purge 全てのMatcherを破棄する
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.matchers = make(map[string]*Matcher)
+	c.epoch++
+}
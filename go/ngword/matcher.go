@@ -0,0 +1,254 @@
+// Package ngword NGワードの判定をAho-Corasick法で行う.
+package ngword
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Mode NGワードの照合方法
+type Mode string
+
+const (
+	// ModeSubstring 部分一致
+	ModeSubstring Mode = "substring"
+	// ModeWord 語として一致 (前後が語の区切り)
+	ModeWord Mode = "word"
+	// ModeRegex 正規表現
+	ModeRegex Mode = "regex"
+)
+
+// ParseMode 空文字列は部分一致として扱う
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", ModeSubstring:
+		return ModeSubstring, nil
+	case ModeWord, ModeRegex:
+		return Mode(s), nil
+	}
+	return "", fmt.Errorf("unknown match mode: %s", s)
+}
+
+// Word NGワード. IDはng_words.idに対応する
+type Word struct {
+	ID   int64
+	Text string
+	Mode Mode
+}
+
+// Validate 登録前にNGワードとして有効か検証する
+func Validate(w Word) error {
+	mode, err := ParseMode(string(w.Mode))
+	if err != nil {
+		return err
+	}
+	if mode == ModeRegex {
+		if _, err := regexp.Compile(w.Text); err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return nil
+	}
+	if Normalize(w.Text) == "" {
+		return errors.New("NG word must not be empty")
+	}
+	return nil
+}
+
+type compiledRegexp struct {
+	index int
+	re    *regexp.Regexp
+}
+
+// Matcher 複数のNGワードをまとめて判定する.
+// 照合は正規化後の文字列に対して行う. 部分一致と語一致はオートマトン、正規表現は個別に評価する.
+// 正規表現もnormalizeRegexpで正規化してから評価する.
+// 構築後は読み取り専用なので、複数のgoroutineから同時に使える
+type Matcher struct {
+	words     []Word
+	substring *automaton
+	word      *automaton
+	regexps   []compiledRegexp
+}
+
+// New NGワードからMatcherを構築する. 正規化すると空になるNGワードや不正な正規表現は無視する
+func New(words []Word) *Matcher {
+	m := &Matcher{
+		substring: newAutomaton(),
+		word:      newAutomaton(),
+	}
+	for _, w := range words {
+		mode, err := ParseMode(string(w.Mode))
+		if err != nil {
+			continue
+		}
+		w.Mode = mode
+
+		switch mode {
+		case ModeSubstring:
+			pattern := Normalize(w.Text)
+			if pattern == "" {
+				continue
+			}
+			m.substring.add(pattern, len(m.words))
+		case ModeWord:
+			pattern := normalizeKeepingSpaces(w.Text)
+			if pattern == "" {
+				continue
+			}
+			m.word.add(pattern, len(m.words))
+		case ModeRegex:
+			expr, err := normalizeRegexp(w.Text)
+			if err != nil {
+				continue
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				continue
+			}
+			m.regexps = append(m.regexps, compiledRegexp{index: len(m.words), re: re})
+		}
+		m.words = append(m.words, w)
+	}
+	m.substring.build()
+	m.word.build()
+	return m
+}
+
+// Len 登録されているNGワードの数
+func (m *Matcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.words)
+}
+
+// Match textに含まれるNGワードのうち、最初に見つかったものを返す
+func (m *Matcher) Match(text string) (Word, bool) {
+	if m.Len() == 0 {
+		return Word{}, false
+	}
+
+	normalized := Normalize(text)
+	if !m.substring.empty() {
+		if index, ok := m.substring.find([]rune(normalized), nil); ok {
+			return m.words[index], true
+		}
+	}
+
+	if !m.word.empty() {
+		runes := []rune(normalizeKeepingSpaces(text))
+		index, ok := m.word.find(runes, func(start, end int) bool {
+			return isWordBoundary(runes, start) && isWordBoundary(runes, end)
+		})
+		if ok {
+			return m.words[index], true
+		}
+	}
+
+	for _, r := range m.regexps {
+		if r.re.MatchString(normalized) {
+			return m.words[r.index], true
+		}
+	}
+	return Word{}, false
+}
+
+type node struct {
+	next map[rune]int
+	fail int
+	// このノードで終わるパターン (failリンク先の出力も含む)
+	outputs []int
+}
+
+type automaton struct {
+	nodes []node
+	// パターンごとの長さ(rune数)
+	lengths map[int]int
+}
+
+func newAutomaton() *automaton {
+	return &automaton{
+		nodes:   []node{{next: map[rune]int{}}},
+		lengths: map[int]int{},
+	}
+}
+
+func (a *automaton) empty() bool {
+	return len(a.lengths) == 0
+}
+
+func (a *automaton) add(pattern string, index int) {
+	cur := 0
+	length := 0
+	for _, r := range pattern {
+		nx, ok := a.nodes[cur].next[r]
+		if !ok {
+			nx = len(a.nodes)
+			a.nodes = append(a.nodes, node{next: map[rune]int{}})
+			a.nodes[cur].next[r] = nx
+		}
+		cur = nx
+		length++
+	}
+	a.nodes[cur].outputs = append(a.nodes[cur].outputs, index)
+	a.lengths[index] = length
+}
+
+// build 幅優先でfailリンクを張る
+func (a *automaton) build() {
+	queue := make([]int, 0, len(a.nodes))
+	for _, child := range a.nodes[0].next {
+		a.nodes[child].fail = 0
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range a.nodes[cur].next {
+			f := a.nodes[cur].fail
+			for {
+				if nx, ok := a.nodes[f].next[r]; ok {
+					a.nodes[child].fail = nx
+					break
+				}
+				if f == 0 {
+					a.nodes[child].fail = 0
+					break
+				}
+				f = a.nodes[f].fail
+			}
+			fail := a.nodes[child].fail
+			a.nodes[child].outputs = append(a.nodes[child].outputs, a.nodes[fail].outputs...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+func (a *automaton) step(cur int, r rune) int {
+	for {
+		if nx, ok := a.nodes[cur].next[r]; ok {
+			return nx
+		}
+		if cur == 0 {
+			return 0
+		}
+		cur = a.nodes[cur].fail
+	}
+}
+
+// find textを1回走査して、acceptが真を返す最初の出現を探す. acceptがnilなら全ての出現を受理する.
+// accept には出現位置を半開区間 [start, end) で渡す
+func (a *automaton) find(text []rune, accept func(start, end int) bool) (int, bool) {
+	cur := 0
+	for i, r := range text {
+		cur = a.step(cur, r)
+		for _, index := range a.nodes[cur].outputs {
+			end := i + 1
+			if accept == nil || accept(end-a.lengths[index], end) {
+				return index, true
+			}
+		}
+	}
+	return 0, false
+}
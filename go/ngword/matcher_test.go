@@ -0,0 +1,162 @@
+package ngword
+
+import "testing"
+
+func TestMatcherSubstring(t *testing.T) {
+	m := New([]Word{
+		{ID: 1, Text: "バカ", Mode: ModeSubstring},
+		{ID: 2, Text: "spam", Mode: ModeSubstring},
+		{ID: 3, Text: "2相コミット"},
+	})
+
+	tests := []struct {
+		name   string
+		text   string
+		wantID int64
+		hit    bool
+	}{
+		{name: "そのまま", text: "このバカ野郎", wantID: 1, hit: true},
+		{name: "ひらがな", text: "このばか野郎", wantID: 1, hit: true},
+		{name: "半角カナ", text: "このﾊﾞｶ野郎", wantID: 1, hit: true},
+		{name: "空白挿入", text: "この バ　カ 野郎", wantID: 1, hit: true},
+		{name: "全角英字", text: "ＳＰＡＭです", wantID: 2, hit: true},
+		{name: "大文字", text: "This is SpAm", wantID: 2, hit: true},
+		{name: "全角数字", text: "２相コミットの話", wantID: 3, hit: true},
+		{name: "モード省略は部分一致", text: "2相コミット", wantID: 3, hit: true},
+		{name: "ヒットしない", text: "こんにちは", hit: false},
+		{name: "途中まで一致", text: "ばらか", hit: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hit := m.Match(tt.text)
+			if hit != tt.hit {
+				t.Fatalf("Match(%q) hit = %v, want %v", tt.text, hit, tt.hit)
+			}
+			if hit && got.ID != tt.wantID {
+				t.Errorf("Match(%q) id = %d, want %d", tt.text, got.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestMatcherWord(t *testing.T) {
+	m := New([]Word{
+		{ID: 1, Text: "馬鹿", Mode: ModeWord},
+		{ID: 2, Text: "ass", Mode: ModeWord},
+		{ID: 3, Text: "アホ", Mode: ModeWord},
+	})
+
+	tests := []struct {
+		name   string
+		text   string
+		wantID int64
+		hit    bool
+	}{
+		{name: "かなに挟まれた漢字", text: "お前は馬鹿だ", wantID: 1, hit: true},
+		{name: "漢字が続く", text: "馬鹿力", hit: false},
+		{name: "英単語", text: "you ass!", wantID: 2, hit: true},
+		{name: "英単語の一部", text: "first class", hit: false},
+		{name: "全角英字", text: "ＡＳＳ", wantID: 2, hit: true},
+		{name: "カタカナ単独", text: "アホ", wantID: 3, hit: true},
+		{name: "漢字との境界", text: "超アホ", wantID: 3, hit: true},
+		{name: "かなが続く", text: "あほらしい", hit: false},
+		{name: "記号との境界", text: "「あほ」", wantID: 3, hit: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hit := m.Match(tt.text)
+			if hit != tt.hit {
+				t.Fatalf("Match(%q) hit = %v, want %v", tt.text, hit, tt.hit)
+			}
+			if hit && got.ID != tt.wantID {
+				t.Errorf("Match(%q) id = %d, want %d", tt.text, got.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestMatcherRegex(t *testing.T) {
+	m := New([]Word{
+		{ID: 1, Text: `し+ね`, Mode: ModeRegex},
+		{ID: 2, Text: `https?://`, Mode: ModeRegex},
+		{ID: 3, Text: `[`, Mode: ModeRegex},
+		{ID: 4, Text: `スパ+ム`, Mode: ModeRegex},
+		{ID: 5, Text: `FREE[A-Z]+COIN`, Mode: ModeRegex},
+		{ID: 6, Text: `[ア-オ]{3}`, Mode: ModeRegex},
+	})
+	if m.Len() != 5 {
+		t.Fatalf("invalid regex should be skipped: Len() = %d", m.Len())
+	}
+
+	tests := []struct {
+		name   string
+		text   string
+		wantID int64
+		hit    bool
+	}{
+		{name: "繰り返し", text: "しししね", wantID: 1, hit: true},
+		{name: "カタカナも正規化後に照合", text: "シネ", wantID: 1, hit: true},
+		{name: "空白挿入", text: "し ね", wantID: 1, hit: true},
+		{name: "URL", text: "見て ＨＴＴＰＳ：／／example.com", wantID: 2, hit: true},
+		{name: "カタカナの正規表現", text: "スパパム", wantID: 4, hit: true},
+		{name: "カタカナの正規表現をひらがなで", text: "すぱむ", wantID: 4, hit: true},
+		{name: "大文字の正規表現", text: "get free BIG coin", wantID: 5, hit: true},
+		{name: "大文字の正規表現を全角で", text: "ＦＲＥＥＸＣＯＩＮ", wantID: 5, hit: true},
+		{name: "カタカナの文字クラス", text: "あいう", wantID: 6, hit: true},
+		{name: "ヒットしない", text: "しんねん", hit: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hit := m.Match(tt.text)
+			if hit != tt.hit {
+				t.Fatalf("Match(%q) hit = %v, want %v", tt.text, hit, tt.hit)
+			}
+			if hit && got.ID != tt.wantID {
+				t.Errorf("Match(%q) id = %d, want %d", tt.text, got.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestMatcherOverlappingPatterns(t *testing.T) {
+	// failリンクを辿って短いパターンを見つけられること
+	m := New([]Word{
+		{ID: 1, Text: "abcd"},
+		{ID: 2, Text: "bc"},
+	})
+	got, hit := m.Match("xabcx")
+	if !hit || got.ID != 2 {
+		t.Errorf("Match() = %+v, %v, want id 2", got, hit)
+	}
+}
+
+func TestMatcherEmpty(t *testing.T) {
+	m := New([]Word{{ID: 1, Text: "  "}})
+	if m.Len() != 0 {
+		t.Errorf("blank word should be skipped: Len() = %d", m.Len())
+	}
+	if _, hit := m.Match("なんでも"); hit {
+		t.Error("empty matcher must not hit")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		word    Word
+		wantErr bool
+	}{
+		{name: "部分一致", word: Word{Text: "ばか"}},
+		{name: "空白のみ", word: Word{Text: "　"}, wantErr: true},
+		{name: "正規表現", word: Word{Text: `\d{3}-\d{4}`, Mode: ModeRegex}},
+		{name: "不正な正規表現", word: Word{Text: `(`, Mode: ModeRegex}, wantErr: true},
+		{name: "不明なモード", word: Word{Text: "ばか", Mode: "fuzzy"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.word); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
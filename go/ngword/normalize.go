@@ -0,0 +1,134 @@
+package ngword
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize 表記揺れによるすり抜けを防ぐため、判定用の文字列に正規化する.
+// NFKC正規化(全角英数・半角カナ)、大文字小文字の畳み込み、カタカナのひらがな化を行い、
+// 空白やゼロ幅文字を取り除く
+func Normalize(s string) string {
+	return normalize(s, false)
+}
+
+// normalizeKeepingSpaces word モード用. 語の区切りを残すため、空白の連続を1つの半角空白にまとめる
+func normalizeKeepingSpaces(s string) string {
+	return strings.TrimSpace(normalize(s, true))
+}
+
+func normalize(s string, keepSpaces bool) string {
+	s = cases.Fold().String(norm.NFKC.String(s))
+
+	var b strings.Builder
+	b.Grow(len(s))
+	lastSpace := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			if keepSpaces && !lastSpace {
+				b.WriteRune(' ')
+			}
+			lastSpace = true
+			continue
+		case unicode.Is(unicode.Cf, r):
+			// ゼロ幅スペース等の不可視文字
+			continue
+		}
+		lastSpace = false
+		b.WriteRune(toHiragana(r))
+	}
+	return b.String()
+}
+
+// maxNormalizedClassRange これより広い文字クラスの範囲は正規化しない. 否定の文字クラス等で全ての文字を辿らないようにする
+const maxNormalizedClassRange = 256
+
+// normalizeRegexp 正規化後の文字列に照合できるよう、正規表現中のリテラルと文字クラスをNormalizeと同じ表記に寄せる.
+// 例えば「スパム」「SPAM」はそれぞれ「すぱむ」「spam」として照合する.
+// 文字クラスは元の文字に正規化後の文字を加える. 空白は照合前に取り除かれるので、空白を含む正規表現はヒットしない
+func normalizeRegexp(expr string) (string, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	normalizeRegexpNode(re)
+	return re.String(), nil
+}
+
+func normalizeRegexpNode(re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		re.Rune = []rune(Normalize(string(re.Rune)))
+		// 大文字小文字は畳み込み済み
+		re.Flags &^= syntax.FoldCase
+		if len(re.Rune) == 0 {
+			re.Op = syntax.OpEmptyMatch
+		}
+	case syntax.OpCharClass:
+		ranges := re.Rune
+		for i := 0; i+1 < len(ranges); i += 2 {
+			lo, hi := ranges[i], ranges[i+1]
+			if hi-lo >= maxNormalizedClassRange {
+				continue
+			}
+			for r := lo; r <= hi; r++ {
+				if n := []rune(Normalize(string(r))); len(n) == 1 && n[0] != r {
+					re.Rune = append(re.Rune, n[0], n[0])
+				}
+			}
+		}
+	}
+	for _, sub := range re.Sub {
+		normalizeRegexpNode(sub)
+	}
+}
+
+// toHiragana カタカナをひらがなに寄せる. 長音符はそのまま残す
+func toHiragana(r rune) rune {
+	switch {
+	case r >= 'ァ' && r <= 'ヶ':
+		return r - ('ァ' - 'ぁ')
+	case r == 'ヽ' || r == 'ヾ':
+		return r - ('ヽ' - 'ゝ')
+	}
+	return r
+}
+
+type script int
+
+const (
+	scriptOther script = iota
+	scriptLatin
+	scriptHan
+	scriptKana
+)
+
+func scriptOf(r rune) script {
+	switch {
+	case r == 'ー' || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+		return scriptKana
+	case unicode.Is(unicode.Han, r):
+		return scriptHan
+	case unicode.IsLetter(r) || unicode.IsNumber(r):
+		return scriptLatin
+	}
+	return scriptOther
+}
+
+// isWordBoundary runes[i-1]とrunes[i]の間が語の区切りか.
+// 日本語は分かち書きされないので、文字種(漢字/かな/英数)が変わる位置も区切りとみなす
+func isWordBoundary(runes []rune, i int) bool {
+	if i <= 0 || i >= len(runes) {
+		return true
+	}
+	a, b := scriptOf(runes[i-1]), scriptOf(runes[i])
+	if a == scriptOther || b == scriptOther {
+		return true
+	}
+	return a != b
+}
@@ -0,0 +1,42 @@
+package ngword
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "全角英数", in: "ＳＰＡＭ１２３", want: "spam123"},
+		{name: "大文字小文字", in: "SpAm", want: "spam"},
+		{name: "カタカナ", in: "バカ", want: "ばか"},
+		{name: "半角カタカナ", in: "ﾊﾞｶ", want: "ばか"},
+		{name: "長音符は残す", in: "アホー", want: "あほー"},
+		{name: "空白の除去", in: "ば か　で す", want: "ばかです"},
+		{name: "ゼロ幅スペース", in: "ば\u200bか", want: "ばか"},
+		{name: "漢字はそのまま", in: "馬鹿", want: "馬鹿"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeKeepingSpaces(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "  Ｈｅｌｌｏ　　Ｗｏｒｌｄ ", want: "hello world"},
+		{in: "お前は　バカだ", want: "お前は ばかだ"},
+	}
+	for _, tt := range tests {
+		if got := normalizeKeepingSpaces(tt.in); got != tt.want {
+			t.Errorf("normalizeKeepingSpaces(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
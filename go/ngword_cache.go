@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/isucon/isucon13/webapp/go/ngword"
+)
+
+const (
+	// NGワードの適用範囲
+	ngwordScopeLivestream = "livestream"
+	ngwordScopeChannel    = "channel"
+	ngwordScopeGlobal     = "global"
+
+	// 他のアプリケーションサーバへNGワードの変更を伝えるRedis pub/subチャンネル
+	ngwordInvalidateChannel = "ngwords:invalidate"
+	ngwordPurgeAll          = "*"
+)
+
+var ngwordMatchers = ngword.NewCache()
+
+func livestreamNGWordKey(livestreamID int64) string {
+	return "livestream:" + strconv.FormatInt(livestreamID, 10)
+}
+
+func channelNGWordKey(userID int64) string {
+	return "channel:" + strconv.FormatInt(userID, 10)
+}
+
+const globalNGWordKey = "global"
+
+// ngwordMatcherKey NGワードが属するMatcherのキャッシュキー
+func ngwordMatcherKey(ngWord *NGWord) string {
+	switch ngWord.Scope {
+	case ngwordScopeChannel:
+		return channelNGWordKey(ngWord.UserID)
+	case ngwordScopeGlobal:
+		return globalNGWordKey
+	}
+	return livestreamNGWordKey(ngWord.LivestreamID)
+}
+
+// matchNGWords 配信、チャンネル(配信者の全配信)、運営の全体NGワードの順に判定する.
+// 呼び出し側のトランザクションのスナップショットで古い内容をキャッシュしないよう、別のトランザクションで読む
+func matchNGWords(ctx context.Context, livestreamModel LivestreamModel, text string) (ngword.Word, bool, error) {
+	loaders := []struct {
+		key   string
+		scope string
+	}{
+		{key: livestreamNGWordKey(livestreamModel.ID), scope: ngwordScopeLivestream},
+		{key: channelNGWordKey(livestreamModel.UserID), scope: ngwordScopeChannel},
+		{key: globalNGWordKey, scope: ngwordScopeGlobal},
+	}
+
+	for _, loader := range loaders {
+		matcher, err := ngwordMatchers.Get(loader.key, func() ([]ngword.Word, error) {
+			tx, err := appStore.Begin(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer tx.Rollback()
+			ngwords, err := tx.Moderation().ListNGWordsByScope(ctx, loader.scope, livestreamModel.UserID, livestreamModel.ID)
+			if err != nil {
+				return nil, err
+			}
+			return toMatcherWords(ngwords), nil
+		})
+		if err != nil {
+			return ngword.Word{}, false, err
+		}
+		if hitWord, hit := matcher.Match(text); hit {
+			return hitWord, true, nil
+		}
+	}
+	return ngword.Word{}, false, nil
+}
+
+func toMatcherWords(ngwords []NGWord) []ngword.Word {
+	words := make([]ngword.Word, len(ngwords))
+	for i := range ngwords {
+		words[i] = ngword.Word{
+			ID:   ngwords[i].ID,
+			Text: ngwords[i].Word,
+			Mode: ngword.Mode(ngwords[i].MatchMode),
+		}
+	}
+	return words
+}
+
+// invalidateNGWordMatcher コミット後に呼ぶこと
+func invalidateNGWordMatcher(ctx context.Context, key string) {
+	ngwordMatchers.Invalidate(key)
+	if err := rdb.Publish(ctx, ngwordInvalidateChannel, key).Err(); err != nil {
+		log.Printf("failed to publish NG word invalidation: %v", err)
+	}
+}
+
+func purgeNGWordMatchers(ctx context.Context) {
+	ngwordMatchers.Purge()
+	if err := rdb.Publish(ctx, ngwordInvalidateChannel, ngwordPurgeAll).Err(); err != nil {
+		log.Printf("failed to publish NG word invalidation: %v", err)
+	}
+}
+
+// subscribeNGWordInvalidation 他のアプリケーションサーバでのNGワード変更を反映する
+func subscribeNGWordInvalidation(ctx context.Context) {
+	pubsub := rdb.Subscribe(ctx, ngwordInvalidateChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		if msg.Payload == ngwordPurgeAll {
+			ngwordMatchers.Purge()
+			continue
+		}
+		ngwordMatchers.Invalidate(msg.Payload)
+	}
+}
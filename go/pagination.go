@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/isucon/isucon13/webapp/go/store"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// pageCursor (created_at, id) の組でページの境界を表す.
+// created_atは秒単位なので、同じ秒のレコードはidで順序を決める
+type pageCursor struct {
+	CreatedAt int64
+	ID        int64
+}
+
+func (p pageCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", p.CreatedAt, p.ID)))
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	createdAt, id, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return pageCursor{}, fmt.Errorf("malformed cursor")
+	}
+	var cursor pageCursor
+	if cursor.CreatedAt, err = strconv.ParseInt(createdAt, 10, 64); err != nil {
+		return pageCursor{}, err
+	}
+	if cursor.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return pageCursor{}, err
+	}
+	return cursor, nil
+}
+
+type pageQuery struct {
+	Limit  int
+	Before *pageCursor
+	After  *pageCursor
+	// Paginated before/afterが指定された場合のみnext_cursor付きのレスポンスを返す.
+	// 指定がない場合は従来通りの配列を返す
+	Paginated bool
+	// Empty 従来の ?limit= に0以下が指定された場合. LIMIT 0と同じく1件も返さない
+	Empty bool
+}
+
+// parsePageQuery limit, before, after クエリパラメータを解釈する.
+// 最初のページは ?before= のように空のカーソルで取得できる
+func parsePageQuery(c echo.Context) (pageQuery, error) {
+	params := c.QueryParams()
+	q := pageQuery{
+		Paginated: params.Has("before") || params.Has("after"),
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return pageQuery{}, echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer")
+		}
+		// 従来の ?limit= のみの指定では、上限を設けず0以下も受け付ける
+		if q.Paginated {
+			if limit < 1 {
+				return pageQuery{}, echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be positive")
+			}
+			q.Limit = min(limit, maxPageLimit)
+		} else {
+			q.Limit = max(limit, 0)
+			q.Empty = limit < 1
+		}
+	} else if q.Paginated {
+		q.Limit = defaultPageLimit
+	}
+
+	before, after := c.QueryParam("before"), c.QueryParam("after")
+	if before != "" && after != "" {
+		return pageQuery{}, echo.NewHTTPError(http.StatusBadRequest, "before and after query parameters are exclusive")
+	}
+	if before != "" {
+		cursor, err := decodePageCursor(before)
+		if err != nil {
+			return pageQuery{}, echo.NewHTTPError(http.StatusBadRequest, "invalid before cursor")
+		}
+		q.Before = &cursor
+	}
+	if after != "" {
+		cursor, err := decodePageCursor(after)
+		if err != nil {
+			return pageQuery{}, echo.NewHTTPError(http.StatusBadRequest, "invalid after cursor")
+		}
+		q.After = &cursor
+	}
+
+	return q, nil
+}
+
+// storePage リポジトリに渡す取得範囲に変換する
+func (q pageQuery) storePage() store.Page {
+	page := store.Page{Limit: q.Limit}
+	if q.Before != nil {
+		page.Before = &store.Cursor{CreatedAt: q.Before.CreatedAt, ID: q.Before.ID}
+	}
+	if q.After != nil {
+		page.After = &store.Cursor{CreatedAt: q.After.CreatedAt, ID: q.After.ID}
+	}
+	return page
+}
+
+// nextCursor 新しい順に並んだ取得結果から次のページのカーソルを返す.
+// beforeでは更に古いページ、afterでは更に新しいページを指す
+func (q pageQuery) nextCursor(count int, newest, oldest pageCursor) *string {
+	if q.After != nil {
+		cursor := q.After.encode()
+		if count > 0 {
+			cursor = newest.encode()
+		}
+		return &cursor
+	}
+	if count == 0 || count < q.Limit {
+		return nil
+	}
+	cursor := oldest.encode()
+	return &cursor
+}
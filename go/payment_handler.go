@@ -16,14 +16,14 @@ func GetPaymentResult(c echo.Context) error {
 	trace.StartSpan(ctx, "getPaymentResult")
 	defer trace.EndSpan(ctx, nil)
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	var totalTip int64
-	if err := tx.GetContext(ctx, &totalTip, "SELECT IFNULL(SUM(tip), 0) FROM livecomments"); err != nil {
+	totalTip, err := tx.Livecomments().GetTotalTip(ctx)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count total tip: "+err.Error())
 	}
 
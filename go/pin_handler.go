@@ -0,0 +1,231 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/isucon/isucon13/webapp/go/store"
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// チップ1あたりのハイライト時間. チップ額に比例して長くハイライトする
+	highlightDurationPerTip = 100 * time.Millisecond
+	maxHighlightDuration    = time.Hour
+)
+
+type LivestreamPinModel = store.LivestreamPin
+
+type PinLivecommentRequest struct {
+	LivecommentID int64 `json:"livecomment_id"`
+}
+
+// HighlightedLivecomments 配信の上部に表示するライブコメント
+type HighlightedLivecomments struct {
+	Pinned *Livecomment `json:"pinned"`
+	// Highlighted ハイライト中のチップ付きライブコメント. チップの多い順
+	Highlighted []Livecomment `json:"highlighted"`
+}
+
+// highlightUntil チップ付きライブコメントのハイライト終了日時. チップがなければハイライトしない
+func highlightUntil(livecommentModel LivecommentModel) *int64 {
+	if livecommentModel.Tip <= 0 {
+		return nil
+	}
+	duration := min(time.Duration(livecommentModel.Tip)*highlightDurationPerTip, maxHighlightDuration)
+	until := time.Unix(livecommentModel.CreatedAt, 0).Add(duration).Unix()
+	return &until
+}
+
+func getHighlightedLivecommentsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "getHighlightedLivecommentsHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	var res HighlightedLivecomments
+
+	pins, err := tx.Livecomments().GetPinsByLivestreamIDs(ctx, []int64{int64(livestreamID)})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get pinned livecomment: "+err.Error())
+	}
+	for _, pin := range pins {
+		pinnedModel, err := tx.Livecomments().GetLivecommentByID(ctx, pin.LivecommentID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get pinned livecomment: "+err.Error())
+		}
+		// 非表示になったライブコメントは固定されていても表示しない
+		if pinnedModel.HiddenAt.Valid {
+			continue
+		}
+		pinned, err := fillLivecommentResponse(ctx, tx, pinnedModel)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment: "+err.Error())
+		}
+		res.Pinned = &pinned
+	}
+
+	// ハイライトは最長でもmaxHighlightDurationなので、それより前の投稿は見ない
+	now := time.Now()
+	tippedModels, err := tx.Livecomments().ListVisibleTippedLivecomments(ctx, int64(livestreamID), now.Add(-maxHighlightDuration).Unix())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
+	}
+	tippedModels = slices.DeleteFunc(tippedModels, func(livecommentModel LivecommentModel) bool {
+		return *highlightUntil(livecommentModel) <= now.Unix()
+	})
+	slices.SortFunc(tippedModels, func(a, b LivecommentModel) int {
+		if a.Tip != b.Tip {
+			return cmp.Compare(b.Tip, a.Tip)
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	res.Highlighted, err = fillLivecommentResponses(ctx, tx, tippedModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// pinLivecommentHandler 配信者がライブコメントを固定する. 固定できるのは配信ごとに1つまで
+func pinLivecommentHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "pinLivecommentHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PinLivecommentRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	livecommentModel, err := tx.Livecomments().GetLivecommentByID(ctx, req.LivecommentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment: "+err.Error())
+	}
+	if err != nil || livecommentModel.LivestreamID != int64(livestreamID) || livecommentModel.HiddenAt.Valid {
+		return echo.NewHTTPError(http.StatusNotFound, "livecomment not found")
+	}
+
+	pinModel := LivestreamPinModel{
+		LivestreamID:  int64(livestreamID),
+		LivecommentID: livecommentModel.ID,
+		PinnedBy:      userID,
+		PinnedAt:      time.Now().Unix(),
+	}
+	if err := tx.Livecomments().UpsertPin(ctx, &pinModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to pin livecomment: "+err.Error())
+	}
+
+	livecomment, err := fillLivecommentResponse(ctx, tx, livecommentModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	if err := publishLivecommentPinned(ctx, int64(livestreamID), &livecomment); err != nil {
+		c.Logger().Warnf("failed to publish pinned livecomment: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, livecomment)
+}
+
+func unpinLivecommentHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "unpinLivecommentHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	if err := tx.Livecomments().DeletePin(ctx, int64(livestreamID)); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unpin livecomment: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	if err := publishLivecommentPinned(ctx, int64(livestreamID), nil); err != nil {
+		c.Logger().Warnf("failed to publish pinned livecomment: %v", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	livecommentRateLimitEnabledEnvKey = "ISUCON13_LIVECOMMENT_RATE_LIMIT_ENABLED"
+	livecommentRateLimitRateEnvKey    = "ISUCON13_LIVECOMMENT_RATE_LIMIT_RATE"
+	livecommentRateLimitBurstEnvKey   = "ISUCON13_LIVECOMMENT_RATE_LIMIT_BURST"
+)
+
+// ライブコメント投稿の全体のレート制限. 配信をまたいでユーザごとに数える
+var livecommentRateLimiter = tokenBucket{
+	prefix:  "ratelimit:livecomment:",
+	enabled: true,
+	rate:    1,
+	burst:   5,
+}
+
+// loadRateLimitConfig 環境変数でライブコメント投稿のレート制限の設定を上書きする.
+// 配信ごとのスローモードは配信者の設定なので、ここでは変更しない
+func loadRateLimitConfig() error {
+	limiter := livecommentRateLimiter
+	if v, ok := os.LookupEnv(livecommentRateLimitEnabledEnvKey); ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("environment variable '%s' must be a boolean", livecommentRateLimitEnabledEnvKey)
+		}
+		limiter.enabled = enabled
+	}
+	if v, ok := os.LookupEnv(livecommentRateLimitRateEnvKey); ok {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("environment variable '%s' must be a positive number", livecommentRateLimitRateEnvKey)
+		}
+		limiter.rate = rate
+	}
+	if v, ok := os.LookupEnv(livecommentRateLimitBurstEnvKey); ok {
+		burst, err := strconv.Atoi(v)
+		if err != nil || burst < 1 {
+			return fmt.Errorf("environment variable '%s' must be a positive integer", livecommentRateLimitBurstEnvKey)
+		}
+		limiter.burst = burst
+	}
+
+	livecommentRateLimiter = limiter
+	return nil
+}
+
+// tokenBucketScript トークンを補充してから1つ取り出す. 取り出せなければ次に取り出せるまでのミリ秒を返す
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return wait
+`)
+
+// tokenBucket Redis上のトークンバケット. 複数のアプリケーションサーバで共有される
+type tokenBucket struct {
+	prefix string
+	// enabled falseなら常にトークンを取り出せる
+	enabled bool
+	// rate 1秒あたりに補充するトークン数
+	rate float64
+	// burst バケットの容量
+	burst int
+}
+
+// take トークンを1つ取り出す. 取り出せなければ再試行までの時間を返す
+func (b tokenBucket) take(ctx context.Context, id int64) (bool, time.Duration, error) {
+	if !b.enabled {
+		return true, 0, nil
+	}
+	key := b.prefix + strconv.FormatInt(id, 10)
+	wait, err := tokenBucketScript.Run(ctx, rdb, []string{key}, b.rate, b.burst, time.Now().UnixMilli()).Int64()
+	if err != nil {
+		return false, 0, err
+	}
+	if wait > 0 {
+		return false, time.Duration(wait) * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
+
+// takeSlowMode 配信のスローモードで、前回の投稿から十分な時間が経っているか確認して記録する
+func takeSlowMode(ctx context.Context, livestreamID int64, userID int64, seconds int64) (bool, time.Duration, error) {
+	key := "slowmode:" + strconv.FormatInt(livestreamID, 10) + ":" + strconv.FormatInt(userID, 10)
+	ok, err := rdb.SetNX(ctx, key, 1, time.Duration(seconds)*time.Second).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	if ok {
+		return true, 0, nil
+	}
+	ttl, err := rdb.PTTL(ctx, key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return false, 0, err
+	}
+	return false, ttl, nil
+}
+
+// tooManyRequests Retry-Afterヘッダを付けて429を返す
+func tooManyRequests(c echo.Context, retryAfter time.Duration, message string) error {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	return echo.NewHTTPError(http.StatusTooManyRequests, message)
+}
@@ -3,24 +3,19 @@ package main
 import (
 	"context"
 	"github.com/goccy/go-json"
-	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
+	"github.com/isucon/isucon13/webapp/go/store"
 	"github.com/isucon/isucon13/webapp/go/trace"
-	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
 
-type ReactionModel struct {
-	ID           int64  `db:"id"`
-	EmojiName    string `db:"emoji_name"`
-	UserID       int64  `db:"user_id"`
-	LivestreamID int64  `db:"livestream_id"`
-	CreatedAt    int64  `db:"created_at"`
-}
+type ReactionModel = store.Reaction
 
 type Reaction struct {
 	ID         int64      `json:"id"`
@@ -30,6 +25,12 @@ type Reaction struct {
 	CreatedAt  int64      `json:"created_at"`
 }
 
+// ReactionsPage before/after指定時のリアクション一覧
+type ReactionsPage struct {
+	Reactions  []Reaction `json:"reactions"`
+	NextCursor *string    `json:"next_cursor"`
+}
+
 type PostReactionRequest struct {
 	EmojiName string `json:"emoji_name"`
 }
@@ -49,41 +50,49 @@ func getReactionsHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	query := "SELECT * FROM reactions WHERE livestream_id = ? ORDER BY created_at DESC"
-	if c.QueryParam("limit") != "" {
-		limit, err := strconv.Atoi(c.QueryParam("limit"))
-		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer")
-		}
-		query += fmt.Sprintf(" LIMIT %d", limit)
+	page, err := parsePageQuery(c)
+	if err != nil {
+		return err
 	}
-
 	reactionModels := []ReactionModel{}
-	if err := tx.SelectContext(ctx, &reactionModels, query, livestreamID); err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "failed to get reactions")
-	}
-
-	reactions := make([]Reaction, len(reactionModels))
-	for i := range reactionModels {
-		reaction, err := fillReactionResponse(ctx, tx, reactionModels[i])
+	if !page.Empty {
+		reactionModels, err = tx.Reactions().ListReactions(ctx, int64(livestreamID), page.storePage())
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
+			return echo.NewHTTPError(http.StatusNotFound, "failed to get reactions")
 		}
+	}
+	if page.After != nil {
+		slices.Reverse(reactionModels)
+	}
 
-		reactions[i] = reaction
+	reactions, err := fillReactionResponses(ctx, tx, reactionModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
-	return c.JSON(http.StatusOK, reactions)
+	if !page.Paginated {
+		return c.JSON(http.StatusOK, reactions)
+	}
+
+	var newest, oldest pageCursor
+	if n := len(reactionModels); n > 0 {
+		newest = pageCursor{CreatedAt: reactionModels[0].CreatedAt, ID: reactionModels[0].ID}
+		oldest = pageCursor{CreatedAt: reactionModels[n-1].CreatedAt, ID: reactionModels[n-1].ID}
+	}
+	return c.JSON(http.StatusOK, &ReactionsPage{
+		Reactions:  reactions,
+		NextCursor: page.nextCursor(len(reactionModels), newest, oldest),
+	})
 }
 
 func postReactionHandler(c echo.Context) error {
@@ -111,64 +120,65 @@ func postReactionHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	reaction, err := insertReaction(ctx, userID, int64(livestreamID), req.EmojiName)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, reaction)
+}
+
+// insertReaction リアクションを登録して配信する. HTTPとWebSocketの両方から使う
+func insertReaction(ctx context.Context, userID int64, livestreamID int64, emojiName string) (Reaction, error) {
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return Reaction{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	reactionModel := ReactionModel{
-		UserID:       int64(userID),
-		LivestreamID: int64(livestreamID),
-		EmojiName:    req.EmojiName,
-		CreatedAt:    time.Now().Unix(),
+	if err := verifyNotBanned(ctx, tx, userID, livestreamID); err != nil {
+		return Reaction{}, err
 	}
 
-	result, err := tx.NamedExecContext(ctx, "INSERT INTO reactions (user_id, livestream_id, emoji_name, created_at) VALUES (:user_id, :livestream_id, :emoji_name, :created_at)", reactionModel)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert reaction: "+err.Error())
+	reactionModel := ReactionModel{
+		UserID:       userID,
+		LivestreamID: livestreamID,
+		EmojiName:    emojiName,
+		CreatedAt:    time.Now().Unix(),
 	}
 
-	reactionID, err := result.LastInsertId()
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted reaction id: "+err.Error())
+	if err := tx.Reactions().CreateReaction(ctx, &reactionModel); err != nil {
+		return Reaction{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert reaction: "+err.Error())
 	}
-	reactionModel.ID = reactionID
 
 	reaction, err := fillReactionResponse(ctx, tx, reactionModel)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
+		return Reaction{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
 	}
 
 	if err := tx.Commit(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+		return Reaction{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
-	return c.JSON(http.StatusCreated, reaction)
+	if err := publishReaction(ctx, reaction); err != nil {
+		log.Printf("failed to publish reaction: %v", err)
+	}
+
+	return reaction, nil
 }
 
-func fillReactionResponse(ctx context.Context, tx *sqlx.Tx, reactionModel ReactionModel) (Reaction, error) {
+func fillReactionResponse(ctx context.Context, tx store.Tx, reactionModel ReactionModel) (Reaction, error) {
 	trace.StartSpan(ctx, "fillReactionResponse")
 	defer trace.EndSpan(ctx, nil)
 
-	userModel := UserModel{}
-	if err := tx.GetContext(ctx, &userModel, "SELECT * FROM users WHERE id = ?", reactionModel.UserID); err != nil {
-		return Reaction{}, err
-	}
-	user, err := fillUserResponse(ctx, tx, userModel)
-	if err != nil {
-		return Reaction{}, err
-	}
-
-	livestreamModel := LivestreamModel{}
-	if err := tx.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", reactionModel.LivestreamID); err != nil {
-		return Reaction{}, err
-	}
-	livestream, err := fillLivestreamResponse(ctx, tx, livestreamModel)
+	reactions, err := fillReactionResponses(ctx, tx, []ReactionModel{reactionModel})
 	if err != nil {
 		return Reaction{}, err
 	}
+	return reactions[0], nil
+}
 
+func newReactionResponse(reactionModel ReactionModel, user User, livestream Livestream) Reaction {
 	reaction := Reaction{
 		ID:         reactionModel.ID,
 		EmojiName:  reactionModel.EmojiName,
@@ -177,5 +187,5 @@ func fillReactionResponse(ctx context.Context, tx *sqlx.Tx, reactionModel Reacti
 		CreatedAt:  reactionModel.CreatedAt,
 	}
 
-	return reaction, nil
+	return reaction
 }
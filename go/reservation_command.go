@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/isucon/isucon13/webapp/go/store"
+	echolog "github.com/labstack/gommon/log"
+)
+
+const reservationUsage = "usage: isupipe reservation extend UNTIL (RFC3339 or YYYY-MM-DD)"
+
+// runReservationCommand isupipe reservation サブコマンド. 終了コードを返す
+func runReservationCommand(args []string) int {
+	if len(args) != 2 || args[0] != "extend" {
+		fmt.Fprintln(os.Stderr, reservationUsage)
+		return 2
+	}
+	until, err := parseReservationUntil(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := loadReservationConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load reservation config: %v\n", err)
+		return 1
+	}
+
+	conn, err := connectDB(echolog.New("reservation"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect db: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	slots, err := extendReservationSlots(context.Background(), store.NewMySQL(conn), until)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to extend reservation_slots: %v\n", err)
+		return 1
+	}
+	if len(slots) == 0 {
+		fmt.Println("reservation_slots already cover the period")
+		return 0
+	}
+	fmt.Printf("created %d reservation_slots from %s to %s\n", len(slots),
+		time.Unix(slots[0].StartAt, 0).UTC().Format(time.RFC3339),
+		time.Unix(slots[len(slots)-1].EndAt, 0).UTC().Format(time.RFC3339))
+	if until.After(reservationTermEndAt) {
+		fmt.Printf("note: reservations after %s are rejected until %s is extended\n", reservationTermEndAt.UTC().Format(time.RFC3339), reservationTermEndAtEnvKey)
+	}
+	return 0
+}
+
+func parseReservationUntil(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must be RFC3339 or YYYY-MM-DD: %s", v)
+}
+
+// extendReservationSlots 最後の予約枠の終了からuntilまでの予約枠を作成し、作成したものを返す.
+// 予約枠がまだなければ予約可能な期間の開始から作成する
+func extendReservationSlots(ctx context.Context, st store.Store, until time.Time) ([]ReservationSlotModel, error) {
+	tx, err := st.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	startAt := reservationTermStartAt.Unix()
+	last, err := tx.Reservations().GetLastSlot(ctx)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		startAt = last.EndAt
+	}
+
+	slots := generateReservationSlots(startAt, until.Unix())
+	if len(slots) == 0 {
+		return nil, nil
+	}
+	if err := tx.Reservations().CreateSlots(ctx, slots); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return slots, nil
+}
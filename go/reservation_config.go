@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	reservationTermStartAtEnvKey  = "ISUCON13_RESERVATION_TERM_START_AT"
+	reservationTermEndAtEnvKey    = "ISUCON13_RESERVATION_TERM_END_AT"
+	reservationSlotMinutesEnvKey  = "ISUCON13_RESERVATION_SLOT_MINUTES"
+	reservationSlotCapacityEnvKey = "ISUCON13_RESERVATION_SLOT_CAPACITY"
+)
+
+var (
+	// reservationSlotDuration 予約枠1つの長さ. 予約区間はこの単位で区切る
+	reservationSlotDuration = time.Hour
+	// reservationSlotCapacity 新しく作る予約枠で同時に予約できる配信の数
+	reservationSlotCapacity int64 = 5
+)
+
+// loadReservationConfig 環境変数で予約可能な期間と予約枠の設定を上書きする.
+// 期間はRFC3339で指定する
+func loadReservationConfig() error {
+	termStartAt, termEndAt := reservationTermStartAt, reservationTermEndAt
+	if v, ok := os.LookupEnv(reservationTermStartAtEnvKey); ok {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("failed to parse environment variable '%s' as RFC3339: %w", reservationTermStartAtEnvKey, err)
+		}
+		termStartAt = t
+	}
+	if v, ok := os.LookupEnv(reservationTermEndAtEnvKey); ok {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("failed to parse environment variable '%s' as RFC3339: %w", reservationTermEndAtEnvKey, err)
+		}
+		termEndAt = t
+	}
+	if !termStartAt.Before(termEndAt) {
+		return fmt.Errorf("reservation term start %s must be before end %s", termStartAt, termEndAt)
+	}
+
+	slotDuration := reservationSlotDuration
+	if v, ok := os.LookupEnv(reservationSlotMinutesEnvKey); ok {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes < 1 {
+			return fmt.Errorf("environment variable '%s' must be a positive integer", reservationSlotMinutesEnvKey)
+		}
+		slotDuration = time.Duration(minutes) * time.Minute
+	}
+	slotCapacity := reservationSlotCapacity
+	if v, ok := os.LookupEnv(reservationSlotCapacityEnvKey); ok {
+		capacity, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || capacity < 1 {
+			return fmt.Errorf("environment variable '%s' must be a positive integer", reservationSlotCapacityEnvKey)
+		}
+		slotCapacity = capacity
+	}
+
+	reservationTermStartAt, reservationTermEndAt = termStartAt, termEndAt
+	reservationSlotDuration, reservationSlotCapacity = slotDuration, slotCapacity
+	return nil
+}
+
+// nextReservationSlotStartAt t以降で最初の予約枠の開始時刻. 予約可能な期間の開始前ならその開始時刻を返す
+func nextReservationSlotStartAt(t int64) int64 {
+	origin := reservationTermStartAt.Unix()
+	if t <= origin {
+		return origin
+	}
+	length := int64(reservationSlotDuration / time.Second)
+	return origin + (t-origin+length-1)/length*length
+}
+
+// generateReservationSlots startAtからendAtまでを予約枠の長さで区切った、残数が最大の予約枠を返す.
+// endAtが区切りに揃っていない場合、最後の予約枠はendAtを超えない範囲までとする
+func generateReservationSlots(startAt, endAt int64) []ReservationSlotModel {
+	length := int64(reservationSlotDuration / time.Second)
+	var slots []ReservationSlotModel
+	for t := startAt; t+length <= endAt; t += length {
+		slots = append(slots, ReservationSlotModel{
+			Slot:    reservationSlotCapacity,
+			StartAt: t,
+			EndAt:   t + length,
+		})
+	}
+	return slots
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/isucon/isucon13/webapp/go/trace"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// 2023/11/25 10:00からの１年間が予約可能な期間. 環境変数で変更できる (loadReservationConfig)
+	reservationTermStartAt = time.Date(2023, 11, 25, 1, 0, 0, 0, time.UTC)
+	reservationTermEndAt   = time.Date(2024, 11, 25, 1, 0, 0, 0, time.UTC)
+)
+
+const (
+	// maxReservationSlotsRange 予約枠一覧で一度に取得できる期間
+	maxReservationSlotsRange = 31 * 24 * 60 * 60
+	// maxReservationWindowHours 空き枠検索で指定できる配信時間
+	maxReservationWindowHours = 24
+)
+
+type ReservationSlot struct {
+	StartAt int64 `json:"start_at"`
+	EndAt   int64 `json:"end_at"`
+	// Remaining あと何件予約できるか
+	Remaining int64 `json:"remaining"`
+}
+
+type ReservationWindow struct {
+	StartAt int64 `json:"start_at"`
+	EndAt   int64 `json:"end_at"`
+}
+
+// inReservationTerm 予約区間が予約可能な期間と重なっているか
+func inReservationTerm(startAt, endAt int64) bool {
+	return time.Unix(startAt, 0).Before(reservationTermEndAt) && time.Unix(endAt, 0).After(reservationTermStartAt)
+}
+
+// parseUnixQueryParam 省略された場合はdefaultValueを返す
+func parseUnixQueryParam(c echo.Context, name string, defaultValue int64) (int64, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+	t, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, name+" query parameter must be unix time")
+	}
+	return t, nil
+}
+
+// 予約枠の残数一覧API
+// GET /api/reservation/slots?from=&to=
+func getReservationSlotsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "getReservationSlotsHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	if c.QueryParam("from") == "" || c.QueryParam("to") == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "from and to query parameters are required")
+	}
+	from, err := parseUnixQueryParam(c, "from", 0)
+	if err != nil {
+		return err
+	}
+	to, err := parseUnixQueryParam(c, "to", 0)
+	if err != nil {
+		return err
+	}
+	if from >= to {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+	if to-from > maxReservationSlotsRange {
+		return echo.NewHTTPError(http.StatusBadRequest, "range between from and to must be within 31 days")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	slotModels, err := tx.Reservations().ListSlots(ctx, from, to)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	slots := make([]ReservationSlot, len(slotModels))
+	for i, slotModel := range slotModels {
+		slots[i] = ReservationSlot{
+			StartAt:   slotModel.StartAt,
+			EndAt:     slotModel.EndAt,
+			Remaining: max(slotModel.Slot, 0),
+		}
+	}
+	return c.JSON(http.StatusOK, slots)
+}
+
+// firstAvailableWindow 開始時刻の順に並んだ予約枠から、連続してhours時間予約できる最初の枠を探す
+func firstAvailableWindow(slots []ReservationSlotModel, hours int64) (ReservationWindow, bool) {
+	length := hours * 60 * 60
+	var (
+		windowStartAt int64
+		prevEndAt     int64
+		running       bool
+	)
+	for _, slot := range slots {
+		if slot.Slot < 1 {
+			running = false
+			continue
+		}
+		// 予約枠の行が抜けている時間は予約できないものとして扱う
+		if !running || slot.StartAt != prevEndAt {
+			windowStartAt = slot.StartAt
+			running = true
+		}
+		prevEndAt = slot.EndAt
+		if slot.EndAt-windowStartAt >= length {
+			return ReservationWindow{StartAt: windowStartAt, EndAt: windowStartAt + length}, true
+		}
+	}
+	return ReservationWindow{}, false
+}
+
+// 指定した長さで予約できる最初の枠の検索API
+// GET /api/reservation/slots/available?hours=&from=&to=
+func getFirstAvailableReservationWindowHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	trace.StartSpan(ctx, "getFirstAvailableReservationWindowHandler")
+	defer trace.EndSpan(ctx, nil)
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	hours, err := strconv.ParseInt(c.QueryParam("hours"), 10, 64)
+	if err != nil || hours < 1 || hours > maxReservationWindowHours {
+		return echo.NewHTTPError(http.StatusBadRequest, "hours query parameter must be between 1 and 24")
+	}
+	// 省略時は開始済みの枠を返さないよう、現在時刻以降の最初の予約枠から探す
+	from, err := parseUnixQueryParam(c, "from", nextReservationSlotStartAt(time.Now().Unix()))
+	if err != nil {
+		return err
+	}
+	to, err := parseUnixQueryParam(c, "to", reservationTermEndAt.Unix())
+	if err != nil {
+		return err
+	}
+	if from >= to {
+		if c.QueryParam("from") == "" {
+			// 予約可能な期間が終わっている
+			return echo.NewHTTPError(http.StatusNotFound, "no available reservation window")
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+
+	tx, err := appStore.Begin(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	slotModels, err := tx.Reservations().ListSlots(ctx, from, to)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	window, ok := firstAvailableWindow(slotModels, hours)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "no available reservation window")
+	}
+	return c.JSON(http.StatusOK, window)
+}
@@ -0,0 +1,57 @@
+// Package seed ベンチマーク開始時に投入する初期データ.
+// sql/init.shからも同じファイルを使っている
+package seed
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/isucon/isucon13/webapp/go/sqlfile"
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Files 投入する順序. 外部キーはないが、init.shと同じ順序にしている
+var Files = []string{
+	"init.sql",
+	"initial_users.sql",
+	"initial_livestreams.sql",
+	"initial_tags.sql",
+	"initial_livestream_tags.sql",
+	"initial_reservation_slots.sql",
+	"initial_reactions.sql",
+	"initial_ngwords.sql",
+	"initial_livecomments.sql",
+}
+
+// Load 全てのファイルを順に実行する. ファイルごとにprogressを呼ぶ
+func Load(ctx context.Context, db *sqlx.DB, progress func(file string, statements int, elapsed time.Duration)) error {
+	// TRUNCATEとINSERTを同じ接続で順に流す
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, file := range Files {
+		start := time.Now()
+		body, err := files.ReadFile("sql/" + file)
+		if err != nil {
+			return err
+		}
+		statements := sqlfile.Split(string(body))
+		for i, statement := range statements {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("%s: statement %d: %w", file, i+1, err)
+			}
+		}
+		if progress != nil {
+			progress(file, len(statements), time.Since(start))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package seed
+
+import (
+	"io/fs"
+	"slices"
+	"testing"
+
+	"github.com/isucon/isucon13/webapp/go/sqlfile"
+)
+
+func TestFiles(t *testing.T) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !slices.Contains(Files, entry.Name()) {
+			t.Errorf("%s is embedded but not loaded", entry.Name())
+		}
+	}
+	for _, file := range Files {
+		body, err := files.ReadFile("sql/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sqlfile.Split(string(body))) == 0 {
+			t.Errorf("%s has no statements", file)
+		}
+	}
+}
@@ -3,12 +3,18 @@ TRUNCATE TABLE icons;
 TRUNCATE TABLE reservation_slots;
 TRUNCATE TABLE livestream_viewers_history;
 TRUNCATE TABLE livecomment_reports;
+TRUNCATE TABLE moderation_logs;
+TRUNCATE TABLE user_bans;
+TRUNCATE TABLE livestream_settings;
+TRUNCATE TABLE moderators;
+TRUNCATE TABLE livestream_pins;
 TRUNCATE TABLE ng_words;
 TRUNCATE TABLE reactions;
 TRUNCATE TABLE tags;
 TRUNCATE TABLE livestream_tags;
 TRUNCATE TABLE livecomments;
 TRUNCATE TABLE livestreams;
+TRUNCATE TABLE livestream_series;
 TRUNCATE TABLE users;
 
 ALTER TABLE `themes` auto_increment = 1;
@@ -17,9 +23,13 @@ ALTER TABLE `reservation_slots` auto_increment = 1;
 ALTER TABLE `livestream_tags` auto_increment = 1;
 ALTER TABLE `livestream_viewers_history` auto_increment = 1;
 ALTER TABLE `livecomment_reports` auto_increment = 1;
+ALTER TABLE `moderation_logs` auto_increment = 1;
+ALTER TABLE `user_bans` auto_increment = 1;
+ALTER TABLE `moderators` auto_increment = 1;
 ALTER TABLE `ng_words` auto_increment = 1;
 ALTER TABLE `reactions` auto_increment = 1;
 ALTER TABLE `tags` auto_increment = 1;
 ALTER TABLE `livecomments` auto_increment = 1;
 ALTER TABLE `livestreams` auto_increment = 1;
+ALTER TABLE `livestream_series` auto_increment = 1;
 ALTER TABLE `users` auto_increment = 1;
\ No newline at end of file
@@ -0,0 +1,30 @@
+// Package sqlfile マイグレーションや初期データのSQLファイルを扱う.
+package sqlfile
+
+import "strings"
+
+// Split ドライバで複数文を一度に実行できないので、行末の;で文を分ける.
+// 行頭が -- の行はコメントとして読み飛ばす.
+// 文字列リテラル中の改行は \n で書かれている前提で、行をまたぐ文字列は扱わない
+func Split(body string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+	)
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
@@ -0,0 +1,28 @@
+package sqlfile
+
+import "testing"
+
+func TestSplit(t *testing.T) {
+	body := `-- コメント
+CREATE TABLE a (
+  -- カラムのコメント
+  id BIGINT NOT NULL
+);
+
+ALTER TABLE a ADD COLUMN b INT;
+SELECT 1`
+	got := Split(body)
+	want := []string{
+		"CREATE TABLE a (\n  id BIGINT NOT NULL\n)",
+		"ALTER TABLE a ADD COLUMN b INT",
+		"SELECT 1",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Split() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("statement %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,1088 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Memory テーブルをメモリ上に持つStore. ハンドラのテストで使う.
+// トランザクションは開始時点の複製に対して操作し、Commitで丸ごと置き換える.
+// 同時に開始したトランザクションは後からCommitした方が優先される.
+// ただし配信と予約枠はロックを使う同時実行を試せるよう、行単位でマージする.
+// これらのForUpdateはMySQLのロック付き読み取りと同じく、コミット済みの最新の行を読む
+type Memory struct {
+	mu     sync.Mutex
+	tables memoryTables
+}
+
+type memoryTables struct {
+	users            []User
+	themes           []Theme
+	livestreams      []Livestream
+	series           []LivestreamSeries
+	tags             []Tag
+	livestreamTags   []LivestreamTag
+	viewers          []LivestreamViewer
+	reservationSlots []ReservationSlot
+	livecomments     []Livecomment
+	reports          []LivecommentReport
+	pins             []LivestreamPin
+	reactions        []Reaction
+	ngWords          []NGWord
+	moderators       []Moderator
+	moderationLogs   []ModerationLog
+	settings         []LivestreamSettings
+	bans             []UserBan
+}
+
+func (t *memoryTables) clone() *memoryTables {
+	return &memoryTables{
+		users:            slices.Clone(t.users),
+		themes:           slices.Clone(t.themes),
+		livestreams:      slices.Clone(t.livestreams),
+		series:           slices.Clone(t.series),
+		tags:             slices.Clone(t.tags),
+		livestreamTags:   slices.Clone(t.livestreamTags),
+		viewers:          slices.Clone(t.viewers),
+		reservationSlots: slices.Clone(t.reservationSlots),
+		livecomments:     slices.Clone(t.livecomments),
+		reports:          slices.Clone(t.reports),
+		pins:             slices.Clone(t.pins),
+		reactions:        slices.Clone(t.reactions),
+		ngWords:          slices.Clone(t.ngWords),
+		moderators:       slices.Clone(t.moderators),
+		moderationLogs:   slices.Clone(t.moderationLogs),
+		settings:         slices.Clone(t.settings),
+		bans:             slices.Clone(t.bans),
+	}
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (s *Memory) Begin(ctx context.Context) (Tx, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &memoryTx{store: s, tables: s.tables.clone(), base: s.tables.clone()}, nil
+}
+
+// seed テスト用の初期データをトランザクションを介さずに投入する
+func (s *Memory) seed(fn func(t *memoryTables)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.tables)
+}
+
+// InsertTags 名前の順にIDを採番してタグを追加する
+func (s *Memory) InsertTags(names ...string) {
+	s.seed(func(t *memoryTables) {
+		for _, name := range names {
+			t.tags = append(t.tags, Tag{ID: nextID(t.tags, func(tag Tag) int64 { return tag.ID }), Name: name})
+		}
+	})
+}
+
+// 以下のInsert系はIDが0なら採番する
+
+func (s *Memory) InsertLivestreams(livestreams ...Livestream) {
+	s.seed(func(t *memoryTables) {
+		for _, livestream := range livestreams {
+			if livestream.ID == 0 {
+				livestream.ID = nextID(t.livestreams, func(livestream Livestream) int64 { return livestream.ID })
+			}
+			t.livestreams = append(t.livestreams, livestream)
+		}
+	})
+}
+
+func (s *Memory) InsertLivestreamTags(livestreamTags ...LivestreamTag) {
+	s.seed(func(t *memoryTables) {
+		for _, livestreamTag := range livestreamTags {
+			if livestreamTag.ID == 0 {
+				livestreamTag.ID = nextID(t.livestreamTags, func(livestreamTag LivestreamTag) int64 { return livestreamTag.ID })
+			}
+			t.livestreamTags = append(t.livestreamTags, livestreamTag)
+		}
+	})
+}
+
+func (s *Memory) InsertReservationSlots(slots ...ReservationSlot) {
+	s.seed(func(t *memoryTables) {
+		for _, slot := range slots {
+			if slot.ID == 0 {
+				slot.ID = nextID(t.reservationSlots, func(slot ReservationSlot) int64 { return slot.ID })
+			}
+			t.reservationSlots = append(t.reservationSlots, slot)
+		}
+	})
+}
+
+func (s *Memory) InsertLivecomments(livecomments ...Livecomment) {
+	s.seed(func(t *memoryTables) {
+		for _, livecomment := range livecomments {
+			if livecomment.ID == 0 {
+				livecomment.ID = nextID(t.livecomments, func(livecomment Livecomment) int64 { return livecomment.ID })
+			}
+			t.livecomments = append(t.livecomments, livecomment)
+		}
+	})
+}
+
+func (s *Memory) InsertReports(reports ...LivecommentReport) {
+	s.seed(func(t *memoryTables) {
+		for _, report := range reports {
+			if report.ID == 0 {
+				report.ID = nextID(t.reports, func(report LivecommentReport) int64 { return report.ID })
+			}
+			t.reports = append(t.reports, report)
+		}
+	})
+}
+
+func (s *Memory) InsertReactions(reactions ...Reaction) {
+	s.seed(func(t *memoryTables) {
+		for _, reaction := range reactions {
+			if reaction.ID == 0 {
+				reaction.ID = nextID(t.reactions, func(reaction Reaction) int64 { return reaction.ID })
+			}
+			t.reactions = append(t.reactions, reaction)
+		}
+	})
+}
+
+func (s *Memory) InsertViewers(viewers ...LivestreamViewer) {
+	s.seed(func(t *memoryTables) {
+		t.viewers = append(t.viewers, viewers...)
+	})
+}
+
+func (s *Memory) InsertPins(pins ...LivestreamPin) {
+	s.seed(func(t *memoryTables) {
+		t.pins = append(t.pins, pins...)
+	})
+}
+
+func (s *Memory) InsertNGWords(ngWords ...NGWord) {
+	s.seed(func(t *memoryTables) {
+		for _, ngWord := range ngWords {
+			if ngWord.ID == 0 {
+				ngWord.ID = nextID(t.ngWords, func(ngWord NGWord) int64 { return ngWord.ID })
+			}
+			t.ngWords = append(t.ngWords, ngWord)
+		}
+	})
+}
+
+func (s *Memory) InsertModerators(moderators ...Moderator) {
+	s.seed(func(t *memoryTables) {
+		for _, moderator := range moderators {
+			if moderator.ID == 0 {
+				moderator.ID = nextID(t.moderators, func(moderator Moderator) int64 { return moderator.ID })
+			}
+			t.moderators = append(t.moderators, moderator)
+		}
+	})
+}
+
+func (s *Memory) InsertBans(bans ...UserBan) {
+	s.seed(func(t *memoryTables) {
+		for _, ban := range bans {
+			if ban.ID == 0 {
+				ban.ID = nextID(t.bans, func(ban UserBan) int64 { return ban.ID })
+			}
+			t.bans = append(t.bans, ban)
+		}
+	})
+}
+
+// nextID AUTO_INCREMENTの代わりに、最大のIDの次を返す
+func nextID[T any](rows []T, id func(T) int64) int64 {
+	var max int64
+	for _, row := range rows {
+		if v := id(row); v > max {
+			max = v
+		}
+	}
+	return max + 1
+}
+
+// find 条件に一致する最初の行を返す. なければErrNotFound
+func find[T any](rows []T, match func(T) bool) (T, error) {
+	for _, row := range rows {
+		if match(row) {
+			return row, nil
+		}
+	}
+	var zero T
+	return zero, ErrNotFound
+}
+
+// filter 条件に一致する行を返す. 一致しなければnilを返すのはSelectContextと同じ
+func filter[T any](rows []T, match func(T) bool) []T {
+	var res []T
+	for _, row := range rows {
+		if match(row) {
+			res = append(res, row)
+		}
+	}
+	return res
+}
+
+// paginate buildPageと同じ条件で絞り込み、並べ替える
+func paginate[T any](rows []T, page Page, cursor func(T) Cursor) []T {
+	less := func(a, b Cursor) bool {
+		return a.CreatedAt < b.CreatedAt || (a.CreatedAt == b.CreatedAt && a.ID < b.ID)
+	}
+	res := []T{}
+	for _, row := range rows {
+		c := cursor(row)
+		if page.After != nil && !less(*page.After, c) {
+			continue
+		}
+		if page.Before != nil && page.After == nil && !less(c, *page.Before) {
+			continue
+		}
+		res = append(res, row)
+	}
+	slices.SortFunc(res, func(a, b T) int {
+		ca, cb := cursor(a), cursor(b)
+		c := cmp.Compare(ca.CreatedAt, cb.CreatedAt)
+		if c == 0 {
+			c = cmp.Compare(ca.ID, cb.ID)
+		}
+		// Afterの場合は古い順、それ以外は新しい順
+		if page.After == nil {
+			c = -c
+		}
+		return c
+	})
+	if page.Limit > 0 && len(res) > page.Limit {
+		res = res[:page.Limit]
+	}
+	return res
+}
+
+func containsID(ids []int64) func(int64) bool {
+	return func(id int64) bool {
+		return slices.Contains(ids, id)
+	}
+}
+
+type memoryTx struct {
+	store  *Memory
+	tables *memoryTables
+	// base 開始時点のテーブル. 行単位でマージするテーブルの変更を求めるのに使う
+	base *memoryTables
+	done bool
+	// locked ロック付きで読んだ行. 2回目以降はトランザクション内の変更を読む
+	locked map[string]bool
+}
+
+func lockKey(table string, id int64) string {
+	return fmt.Sprintf("%s:%d", table, id)
+}
+
+// lockRows matchに当てはまる行のうち、まだロックしていないものをコミット済みの最新の内容で置き換える
+func lockRows[T any](t *memoryTx, name string, table func(*memoryTables) *[]T, id func(T) int64, match func(T) bool) {
+	t.store.mu.Lock()
+	committed := filter(*table(&t.store.tables), match)
+	t.store.mu.Unlock()
+
+	if t.locked == nil {
+		t.locked = map[string]bool{}
+	}
+	key := func(row T) string { return lockKey(name, id(row)) }
+	rows := table(t.tables)
+	// 他のトランザクションで削除された行
+	*rows = slices.DeleteFunc(*rows, func(row T) bool {
+		return match(row) && !t.locked[key(row)] && !slices.ContainsFunc(committed, func(c T) bool { return id(c) == id(row) })
+	})
+	for _, row := range committed {
+		if t.locked[key(row)] {
+			continue
+		}
+		t.locked[key(row)] = true
+		if i := slices.IndexFunc(*rows, func(r T) bool { return id(r) == id(row) }); i >= 0 {
+			(*rows)[i] = row
+		} else {
+			*rows = append(*rows, row)
+		}
+	}
+}
+
+func (t *memoryTx) Users() UserRepository               { return (*memoryUsers)(t) }
+func (t *memoryTx) Livestreams() LivestreamRepository   { return (*memoryLivestreams)(t) }
+func (t *memoryTx) Livecomments() LivecommentRepository { return (*memoryLivecomments)(t) }
+func (t *memoryTx) Reactions() ReactionRepository       { return (*memoryReactions)(t) }
+func (t *memoryTx) Reservations() ReservationRepository { return (*memoryReservations)(t) }
+func (t *memoryTx) Moderation() ModerationRepository    { return (*memoryModeration)(t) }
+
+func (t *memoryTx) Commit() error {
+	if t.done {
+		return fmt.Errorf("transaction has already been committed or rolled back")
+	}
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	committed := t.store.tables
+	t.store.tables = *t.tables
+	t.store.tables.livestreams = mergeRows(t, "livestreams", t.base.livestreams, t.tables.livestreams, committed.livestreams, func(livestream Livestream) int64 { return livestream.ID })
+	t.store.tables.reservationSlots = mergeRows(t, "reservation_slots", t.base.reservationSlots, t.tables.reservationSlots, committed.reservationSlots, func(slot ReservationSlot) int64 { return slot.ID })
+	t.done = true
+	return nil
+}
+
+// mergeRows トランザクションで変更した行とロックした行だけをコミット済みの行に反映する
+func mergeRows[T comparable](t *memoryTx, name string, base, changed, committed []T, id func(T) int64) []T {
+	merged := slices.Clone(committed)
+	for _, row := range base {
+		if !slices.ContainsFunc(changed, func(c T) bool { return id(c) == id(row) }) {
+			merged = slices.DeleteFunc(merged, func(m T) bool { return id(m) == id(row) })
+		}
+	}
+	for _, row := range changed {
+		if !t.locked[lockKey(name, id(row))] && slices.Contains(base, row) {
+			continue
+		}
+		if i := slices.IndexFunc(merged, func(m T) bool { return id(m) == id(row) }); i >= 0 {
+			merged[i] = row
+		} else {
+			merged = append(merged, row)
+		}
+	}
+	return merged
+}
+
+func (t *memoryTx) Rollback() error {
+	t.done = true
+	return nil
+}
+
+type memoryUsers memoryTx
+
+func (r *memoryUsers) GetUserByID(ctx context.Context, id int64) (User, error) {
+	return find(r.tables.users, func(user User) bool { return user.ID == id })
+}
+
+func (r *memoryUsers) GetUserByName(ctx context.Context, name string) (User, error) {
+	return find(r.tables.users, func(user User) bool { return user.Name == name })
+}
+
+func (r *memoryUsers) GetUsersByIDs(ctx context.Context, ids []int64) ([]User, error) {
+	in := containsID(ids)
+	return filter(r.tables.users, func(user User) bool { return in(user.ID) }), nil
+}
+
+func (r *memoryUsers) ListUsers(ctx context.Context) ([]User, error) {
+	return slices.Clone(r.tables.users), nil
+}
+
+func (r *memoryUsers) CreateUser(ctx context.Context, user *User) error {
+	// usersのnameはUNIQUE
+	if _, err := r.GetUserByName(ctx, user.Name); err == nil {
+		return fmt.Errorf("duplicate entry '%s' for key 'users.name'", user.Name)
+	}
+	user.ID = nextID(r.tables.users, func(user User) int64 { return user.ID })
+	r.tables.users = append(r.tables.users, *user)
+	return nil
+}
+
+func (r *memoryUsers) GetTheme(ctx context.Context, userID int64) (Theme, error) {
+	return find(r.tables.themes, func(theme Theme) bool { return theme.UserID == userID })
+}
+
+func (r *memoryUsers) GetThemesByUserIDs(ctx context.Context, userIDs []int64) ([]Theme, error) {
+	in := containsID(userIDs)
+	return filter(r.tables.themes, func(theme Theme) bool { return in(theme.UserID) }), nil
+}
+
+func (r *memoryUsers) CreateTheme(ctx context.Context, theme *Theme) error {
+	theme.ID = nextID(r.tables.themes, func(theme Theme) int64 { return theme.ID })
+	r.tables.themes = append(r.tables.themes, *theme)
+	return nil
+}
+
+type memoryLivestreams memoryTx
+
+func (r *memoryLivestreams) GetLivestreamByID(ctx context.Context, id int64) (Livestream, error) {
+	return find(r.tables.livestreams, func(livestream Livestream) bool { return livestream.ID == id })
+}
+
+func (r *memoryLivestreams) GetLivestreamByIDForUpdate(ctx context.Context, id int64) (Livestream, error) {
+	match := func(livestream Livestream) bool { return livestream.ID == id }
+	lockRows((*memoryTx)(r), "livestreams", func(t *memoryTables) *[]Livestream { return &t.livestreams }, func(livestream Livestream) int64 { return livestream.ID }, match)
+	return find(r.tables.livestreams, match)
+}
+
+func (r *memoryLivestreams) GetLivestreamsByIDs(ctx context.Context, ids []int64) ([]Livestream, error) {
+	in := containsID(ids)
+	livestreams := filter(r.tables.livestreams, func(livestream Livestream) bool { return in(livestream.ID) })
+	slices.SortFunc(livestreams, func(a, b Livestream) int { return cmp.Compare(b.ID, a.ID) })
+	return livestreams, nil
+}
+
+func (r *memoryLivestreams) GetLivestreamsByUserID(ctx context.Context, userID int64) ([]Livestream, error) {
+	return filter(r.tables.livestreams, func(livestream Livestream) bool { return livestream.UserID == userID }), nil
+}
+
+func (r *memoryLivestreams) ListLivestreams(ctx context.Context, limit int) ([]Livestream, error) {
+	livestreams := slices.Clone(r.tables.livestreams)
+	slices.SortFunc(livestreams, func(a, b Livestream) int { return cmp.Compare(b.ID, a.ID) })
+	if limit > 0 && len(livestreams) > limit {
+		livestreams = livestreams[:limit]
+	}
+	return livestreams, nil
+}
+
+func (r *memoryLivestreams) CreateLivestream(ctx context.Context, livestream *Livestream) error {
+	livestream.ID = nextID(r.tables.livestreams, func(livestream Livestream) int64 { return livestream.ID })
+	r.tables.livestreams = append(r.tables.livestreams, *livestream)
+	return nil
+}
+
+func (r *memoryLivestreams) UpdateLivestream(ctx context.Context, livestream *Livestream) error {
+	for i := range r.tables.livestreams {
+		if r.tables.livestreams[i].ID == livestream.ID {
+			r.tables.livestreams[i] = *livestream
+		}
+	}
+	return nil
+}
+
+func (r *memoryLivestreams) DeleteLivestream(ctx context.Context, id int64) (bool, error) {
+	n := len(r.tables.livestreams)
+	r.tables.livestreams = slices.DeleteFunc(r.tables.livestreams, func(livestream Livestream) bool { return livestream.ID == id })
+	return len(r.tables.livestreams) < n, nil
+}
+
+func (r *memoryLivestreams) GetSeriesByID(ctx context.Context, id int64) (LivestreamSeries, error) {
+	return find(r.tables.series, func(series LivestreamSeries) bool { return series.ID == id })
+}
+
+func (r *memoryLivestreams) CreateSeries(ctx context.Context, series *LivestreamSeries) error {
+	series.ID = nextID(r.tables.series, func(series LivestreamSeries) int64 { return series.ID })
+	r.tables.series = append(r.tables.series, *series)
+	return nil
+}
+
+func (r *memoryLivestreams) GetLivestreamsBySeriesID(ctx context.Context, seriesID int64) ([]Livestream, error) {
+	livestreams := filter(r.tables.livestreams, func(livestream Livestream) bool {
+		return livestream.SeriesID.Valid && livestream.SeriesID.Int64 == seriesID
+	})
+	slices.SortFunc(livestreams, func(a, b Livestream) int { return cmp.Compare(a.StartAt, b.StartAt) })
+	return livestreams, nil
+}
+
+func (r *memoryLivestreams) GetTags(ctx context.Context) ([]Tag, error) {
+	return slices.Clone(r.tables.tags), nil
+}
+
+func (r *memoryLivestreams) GetTagsByIDs(ctx context.Context, ids []int64) ([]Tag, error) {
+	in := containsID(ids)
+	return filter(r.tables.tags, func(tag Tag) bool { return in(tag.ID) }), nil
+}
+
+func (r *memoryLivestreams) GetTagIDsByName(ctx context.Context, name string) ([]int64, error) {
+	var ids []int64
+	for _, tag := range r.tables.tags {
+		if tag.Name == name {
+			ids = append(ids, tag.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memoryLivestreams) GetLivestreamTagsByLivestreamIDs(ctx context.Context, livestreamIDs []int64) ([]LivestreamTag, error) {
+	in := containsID(livestreamIDs)
+	return filter(r.tables.livestreamTags, func(livestreamTag LivestreamTag) bool { return in(livestreamTag.LivestreamID) }), nil
+}
+
+func (r *memoryLivestreams) GetLivestreamTagsByTagIDs(ctx context.Context, tagIDs []int64) ([]LivestreamTag, error) {
+	in := containsID(tagIDs)
+	livestreamTags := filter(r.tables.livestreamTags, func(livestreamTag LivestreamTag) bool { return in(livestreamTag.TagID) })
+	slices.SortStableFunc(livestreamTags, func(a, b LivestreamTag) int { return cmp.Compare(b.LivestreamID, a.LivestreamID) })
+	return livestreamTags, nil
+}
+
+func (r *memoryLivestreams) CreateLivestreamTag(ctx context.Context, livestreamTag *LivestreamTag) error {
+	livestreamTag.ID = nextID(r.tables.livestreamTags, func(livestreamTag LivestreamTag) int64 { return livestreamTag.ID })
+	r.tables.livestreamTags = append(r.tables.livestreamTags, *livestreamTag)
+	return nil
+}
+
+func (r *memoryLivestreams) DeleteLivestreamTags(ctx context.Context, livestreamID int64) error {
+	r.tables.livestreamTags = slices.DeleteFunc(r.tables.livestreamTags, func(livestreamTag LivestreamTag) bool {
+		return livestreamTag.LivestreamID == livestreamID
+	})
+	return nil
+}
+
+func (r *memoryLivestreams) CreateViewer(ctx context.Context, viewer *LivestreamViewer) error {
+	r.tables.viewers = append(r.tables.viewers, *viewer)
+	return nil
+}
+
+func (r *memoryLivestreams) DeleteViewer(ctx context.Context, userID, livestreamID int64) error {
+	r.tables.viewers = slices.DeleteFunc(r.tables.viewers, func(viewer LivestreamViewer) bool {
+		return viewer.UserID == userID && viewer.LivestreamID == livestreamID
+	})
+	return nil
+}
+
+func (r *memoryLivestreams) DeleteViewers(ctx context.Context, livestreamID int64) error {
+	r.tables.viewers = slices.DeleteFunc(r.tables.viewers, func(viewer LivestreamViewer) bool { return viewer.LivestreamID == livestreamID })
+	return nil
+}
+
+func (r *memoryLivestreams) CountViewers(ctx context.Context, livestreamID int64) (int64, error) {
+	viewers := filter(r.tables.viewers, func(viewer LivestreamViewer) bool { return viewer.LivestreamID == livestreamID })
+	return int64(len(viewers)), nil
+}
+
+type memoryLivecomments memoryTx
+
+func (r *memoryLivecomments) GetLivecommentByID(ctx context.Context, id int64) (Livecomment, error) {
+	return find(r.tables.livecomments, func(livecomment Livecomment) bool { return livecomment.ID == id })
+}
+
+func (r *memoryLivecomments) GetLivecommentsByIDs(ctx context.Context, ids []int64) ([]Livecomment, error) {
+	in := containsID(ids)
+	return filter(r.tables.livecomments, func(livecomment Livecomment) bool { return in(livecomment.ID) }), nil
+}
+
+func (r *memoryLivecomments) GetLivecommentForUpdate(ctx context.Context, id int64) (Livecomment, error) {
+	return r.GetLivecommentByID(ctx, id)
+}
+
+func (r *memoryLivecomments) ListLivecomments(ctx context.Context, livestreamID int64) ([]Livecomment, error) {
+	return filter(r.tables.livecomments, func(livecomment Livecomment) bool { return livecomment.LivestreamID == livestreamID }), nil
+}
+
+func (r *memoryLivecomments) ListVisibleLivecomments(ctx context.Context, livestreamID int64, page Page) ([]Livecomment, error) {
+	livecomments := filter(r.tables.livecomments, func(livecomment Livecomment) bool {
+		return livecomment.LivestreamID == livestreamID && !livecomment.HiddenAt.Valid
+	})
+	return paginate(livecomments, page, func(livecomment Livecomment) Cursor {
+		return Cursor{CreatedAt: livecomment.CreatedAt, ID: livecomment.ID}
+	}), nil
+}
+
+func (r *memoryLivecomments) ListVisibleLivecommentsAfter(ctx context.Context, livestreamID, afterID int64) ([]Livecomment, error) {
+	livecomments := filter(r.tables.livecomments, func(livecomment Livecomment) bool {
+		return livecomment.LivestreamID == livestreamID && livecomment.ID > afterID && !livecomment.HiddenAt.Valid
+	})
+	slices.SortFunc(livecomments, func(a, b Livecomment) int { return cmp.Compare(a.ID, b.ID) })
+	return livecomments, nil
+}
+
+func (r *memoryLivecomments) ListVisibleTippedLivecomments(ctx context.Context, livestreamID, since int64) ([]Livecomment, error) {
+	return filter(r.tables.livecomments, func(livecomment Livecomment) bool {
+		return livecomment.LivestreamID == livestreamID && livecomment.Tip > 0 && livecomment.CreatedAt >= since && !livecomment.HiddenAt.Valid
+	}), nil
+}
+
+func (r *memoryLivecomments) ListUnmoderatedLivecomments(ctx context.Context, livestreamID int64) ([]Livecomment, error) {
+	return filter(r.tables.livecomments, func(livecomment Livecomment) bool {
+		return livecomment.LivestreamID == livestreamID && !livecomment.HiddenAt.Valid && !livecomment.ModerationLogID.Valid
+	}), nil
+}
+
+func (r *memoryLivecomments) ListLivecommentsByModerationLogID(ctx context.Context, moderationLogID int64) ([]Livecomment, error) {
+	livecomments := filter(r.tables.livecomments, func(livecomment Livecomment) bool {
+		return livecomment.ModerationLogID.Valid && livecomment.ModerationLogID.Int64 == moderationLogID
+	})
+	slices.SortFunc(livecomments, func(a, b Livecomment) int { return cmp.Compare(a.ID, b.ID) })
+	return livecomments, nil
+}
+
+func (r *memoryLivecomments) CreateLivecomment(ctx context.Context, livecomment *Livecomment) error {
+	livecomment.ID = nextID(r.tables.livecomments, func(livecomment Livecomment) int64 { return livecomment.ID })
+	r.tables.livecomments = append(r.tables.livecomments, *livecomment)
+	return nil
+}
+
+// updateLivecomments 条件に一致するライブコメントをfnで書き換える
+func (r *memoryLivecomments) updateLivecomments(match func(Livecomment) bool, fn func(*Livecomment)) {
+	for i := range r.tables.livecomments {
+		if match(r.tables.livecomments[i]) {
+			fn(&r.tables.livecomments[i])
+		}
+	}
+}
+
+func (r *memoryLivecomments) UpdateLivecomment(ctx context.Context, livecomment *Livecomment) error {
+	r.updateLivecomments(func(l Livecomment) bool { return l.ID == livecomment.ID }, func(l *Livecomment) {
+		l.Comment = livecomment.Comment
+		l.EditedAt = livecomment.EditedAt
+	})
+	return nil
+}
+
+func (r *memoryLivecomments) HideLivecomments(ctx context.Context, ids []int64, hiddenAt int64, reason string, ngWordID sql.NullInt64, moderationLogID int64) error {
+	in := containsID(ids)
+	r.updateLivecomments(func(l Livecomment) bool { return in(l.ID) }, func(l *Livecomment) {
+		l.HiddenAt = sql.NullInt64{Int64: hiddenAt, Valid: true}
+		l.HiddenReason = sql.NullString{String: reason, Valid: true}
+		l.HiddenNGWordID = ngWordID
+		l.ModerationLogID = sql.NullInt64{Int64: moderationLogID, Valid: true}
+	})
+	return nil
+}
+
+func (r *memoryLivecomments) HideLivecommentByAuthor(ctx context.Context, id int64, hiddenAt int64, reason string) error {
+	r.updateLivecomments(func(l Livecomment) bool { return l.ID == id }, func(l *Livecomment) {
+		l.HiddenAt = sql.NullInt64{Int64: hiddenAt, Valid: true}
+		l.HiddenReason = sql.NullString{String: reason, Valid: true}
+	})
+	return nil
+}
+
+func (r *memoryLivecomments) RestoreLivecomment(ctx context.Context, id int64) error {
+	r.updateLivecomments(func(l Livecomment) bool { return l.ID == id }, func(l *Livecomment) {
+		l.HiddenAt = sql.NullInt64{}
+	})
+	return nil
+}
+
+func (r *memoryLivecomments) RestoreLivecommentsByModerationLogID(ctx context.Context, moderationLogID int64) error {
+	r.updateLivecomments(func(l Livecomment) bool {
+		return l.ModerationLogID.Valid && l.ModerationLogID.Int64 == moderationLogID
+	}, func(l *Livecomment) {
+		l.HiddenAt = sql.NullInt64{}
+	})
+	return nil
+}
+
+func (r *memoryLivecomments) DeleteLivecomments(ctx context.Context, livestreamID int64) error {
+	r.tables.livecomments = slices.DeleteFunc(r.tables.livecomments, func(livecomment Livecomment) bool { return livecomment.LivestreamID == livestreamID })
+	return nil
+}
+
+func (r *memoryLivecomments) GetTotalTip(ctx context.Context) (int64, error) {
+	var total int64
+	for _, livecomment := range r.tables.livecomments {
+		total += livecomment.Tip
+	}
+	return total, nil
+}
+
+func (r *memoryLivecomments) GetTipStats(ctx context.Context, livestreamID int64) (int64, int64, error) {
+	var total, max int64
+	for _, livecomment := range r.tables.livecomments {
+		if livecomment.LivestreamID == livestreamID {
+			total += livecomment.Tip
+			if livecomment.Tip > max {
+				max = livecomment.Tip
+			}
+		}
+	}
+	return total, max, nil
+}
+
+func (r *memoryLivecomments) GetPinsByLivestreamIDs(ctx context.Context, livestreamIDs []int64) ([]LivestreamPin, error) {
+	in := containsID(livestreamIDs)
+	return filter(r.tables.pins, func(pin LivestreamPin) bool { return in(pin.LivestreamID) }), nil
+}
+
+func (r *memoryLivecomments) UpsertPin(ctx context.Context, pin *LivestreamPin) error {
+	r.tables.pins = slices.DeleteFunc(r.tables.pins, func(p LivestreamPin) bool { return p.LivestreamID == pin.LivestreamID })
+	r.tables.pins = append(r.tables.pins, *pin)
+	return nil
+}
+
+func (r *memoryLivecomments) DeletePin(ctx context.Context, livestreamID int64) error {
+	r.tables.pins = slices.DeleteFunc(r.tables.pins, func(pin LivestreamPin) bool { return pin.LivestreamID == livestreamID })
+	return nil
+}
+
+func (r *memoryLivecomments) GetReportByID(ctx context.Context, id int64) (LivecommentReport, error) {
+	return find(r.tables.reports, func(report LivecommentReport) bool { return report.ID == id })
+}
+
+func (r *memoryLivecomments) GetReportForUpdate(ctx context.Context, id int64) (LivecommentReport, error) {
+	return r.GetReportByID(ctx, id)
+}
+
+func (r *memoryLivecomments) ListReports(ctx context.Context, livestreamID int64, status string) ([]LivecommentReport, error) {
+	return filter(r.tables.reports, func(report LivecommentReport) bool {
+		return report.LivestreamID == livestreamID && (status == "" || report.Status == status)
+	}), nil
+}
+
+func (r *memoryLivecomments) CountOpenReporters(ctx context.Context, livecommentID int64) (int64, error) {
+	reporters := make(map[int64]struct{})
+	for _, report := range r.tables.reports {
+		if report.LivecommentID == livecommentID && report.Status == "open" {
+			reporters[report.UserID] = struct{}{}
+		}
+	}
+	return int64(len(reporters)), nil
+}
+
+func (r *memoryLivecomments) CreateReport(ctx context.Context, report *LivecommentReport) error {
+	// uniq_livecomment_reporter
+	if slices.ContainsFunc(r.tables.reports, func(r LivecommentReport) bool {
+		return r.LivecommentID == report.LivecommentID && r.UserID == report.UserID
+	}) {
+		return ErrDuplicate
+	}
+	report.ID = nextID(r.tables.reports, func(report LivecommentReport) int64 { return report.ID })
+	r.tables.reports = append(r.tables.reports, *report)
+	return nil
+}
+
+func (r *memoryLivecomments) ResolveReports(ctx context.Context, livecommentID int64, status, action string, resolvedBy, resolvedAt int64) error {
+	for i := range r.tables.reports {
+		if report := &r.tables.reports[i]; report.LivecommentID == livecommentID && report.Status == "open" {
+			report.Status = status
+			report.Action = sql.NullString{String: action, Valid: true}
+			report.ResolvedBy = sql.NullInt64{Int64: resolvedBy, Valid: true}
+			report.ResolvedAt = sql.NullInt64{Int64: resolvedAt, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (r *memoryLivecomments) DeleteReports(ctx context.Context, livestreamID int64) error {
+	r.tables.reports = slices.DeleteFunc(r.tables.reports, func(report LivecommentReport) bool { return report.LivestreamID == livestreamID })
+	return nil
+}
+
+type memoryReactions memoryTx
+
+func (r *memoryReactions) ListReactions(ctx context.Context, livestreamID int64, page Page) ([]Reaction, error) {
+	reactions := filter(r.tables.reactions, func(reaction Reaction) bool { return reaction.LivestreamID == livestreamID })
+	return paginate(reactions, page, func(reaction Reaction) Cursor {
+		return Cursor{CreatedAt: reaction.CreatedAt, ID: reaction.ID}
+	}), nil
+}
+
+func (r *memoryReactions) CreateReaction(ctx context.Context, reaction *Reaction) error {
+	reaction.ID = nextID(r.tables.reactions, func(reaction Reaction) int64 { return reaction.ID })
+	r.tables.reactions = append(r.tables.reactions, *reaction)
+	return nil
+}
+
+func (r *memoryReactions) DeleteReactions(ctx context.Context, livestreamID int64) error {
+	r.tables.reactions = slices.DeleteFunc(r.tables.reactions, func(reaction Reaction) bool { return reaction.LivestreamID == livestreamID })
+	return nil
+}
+
+func (r *memoryReactions) CountReactions(ctx context.Context, livestreamID int64) (int64, error) {
+	reactions := filter(r.tables.reactions, func(reaction Reaction) bool { return reaction.LivestreamID == livestreamID })
+	return int64(len(reactions)), nil
+}
+
+// streamerReactions 配信者の全配信へのリアクション
+func (r *memoryReactions) streamerReactions(streamerID int64) []Reaction {
+	var livestreamIDs []int64
+	for _, livestream := range r.tables.livestreams {
+		if livestream.UserID == streamerID {
+			livestreamIDs = append(livestreamIDs, livestream.ID)
+		}
+	}
+	in := containsID(livestreamIDs)
+	return filter(r.tables.reactions, func(reaction Reaction) bool { return in(reaction.LivestreamID) })
+}
+
+func (r *memoryReactions) CountReactionsByStreamerID(ctx context.Context, streamerID int64) (int64, error) {
+	return int64(len(r.streamerReactions(streamerID))), nil
+}
+
+func (r *memoryReactions) GetFavoriteEmoji(ctx context.Context, streamerID int64) (string, error) {
+	counts := make(map[string]int)
+	for _, reaction := range r.streamerReactions(streamerID) {
+		counts[reaction.EmojiName]++
+	}
+	var favorite string
+	for emojiName, count := range counts {
+		// 同数なら名前の大きい方を選ぶのはORDER BYと同じ
+		if count > counts[favorite] || (count == counts[favorite] && emojiName > favorite) {
+			favorite = emojiName
+		}
+	}
+	return favorite, nil
+}
+
+type memoryReservations memoryTx
+
+func (r *memoryReservations) ListSlots(ctx context.Context, startAt, endAt int64) ([]ReservationSlot, error) {
+	slots := filter(r.tables.reservationSlots, func(slot ReservationSlot) bool {
+		return slot.StartAt >= startAt && slot.EndAt <= endAt
+	})
+	slices.SortFunc(slots, func(a, b ReservationSlot) int { return cmp.Compare(a.StartAt, b.StartAt) })
+	if slots == nil {
+		slots = []ReservationSlot{}
+	}
+	return slots, nil
+}
+
+func (r *memoryReservations) GetSlotsForUpdate(ctx context.Context, startAt, endAt int64) ([]ReservationSlot, error) {
+	match := func(slot ReservationSlot) bool { return slotOverlaps(slot, startAt, endAt) }
+	lockRows((*memoryTx)(r), "reservation_slots", func(t *memoryTables) *[]ReservationSlot { return &t.reservationSlots }, func(slot ReservationSlot) int64 { return slot.ID }, match)
+	return filter(r.tables.reservationSlots, match), nil
+}
+
+// slotOverlaps 予約枠がstartAt~endAtと一部でも重なるか
+func slotOverlaps(slot ReservationSlot, startAt, endAt int64) bool {
+	return slot.StartAt < endAt && slot.EndAt > startAt
+}
+
+func (r *memoryReservations) DecrementSlots(ctx context.Context, startAt, endAt int64) error {
+	for i := range r.tables.reservationSlots {
+		if slot := &r.tables.reservationSlots[i]; slotOverlaps(*slot, startAt, endAt) {
+			slot.Slot--
+		}
+	}
+	return nil
+}
+
+func (r *memoryReservations) IncrementSlots(ctx context.Context, startAt, endAt int64) error {
+	for i := range r.tables.reservationSlots {
+		if slot := &r.tables.reservationSlots[i]; slotOverlaps(*slot, startAt, endAt) {
+			slot.Slot++
+		}
+	}
+	return nil
+}
+
+func (r *memoryReservations) GetLastSlot(ctx context.Context) (ReservationSlot, error) {
+	if len(r.tables.reservationSlots) == 0 {
+		return ReservationSlot{}, ErrNotFound
+	}
+	return slices.MaxFunc(r.tables.reservationSlots, func(a, b ReservationSlot) int { return cmp.Compare(a.EndAt, b.EndAt) }), nil
+}
+
+func (r *memoryReservations) CreateSlots(ctx context.Context, slots []ReservationSlot) error {
+	for _, slot := range slots {
+		slot.ID = nextID(r.tables.reservationSlots, func(slot ReservationSlot) int64 { return slot.ID })
+		r.tables.reservationSlots = append(r.tables.reservationSlots, slot)
+	}
+	return nil
+}
+
+type memoryModeration memoryTx
+
+func (r *memoryModeration) GetModeratorPermissions(ctx context.Context, streamerID, livestreamID, userID int64) ([]string, error) {
+	var permissionsList []string
+	for _, moderator := range r.tables.moderators {
+		if moderator.StreamerID != streamerID || moderator.UserID != userID {
+			continue
+		}
+		if moderator.Scope == "channel" || (moderator.Scope == "livestream" && moderator.LivestreamID == livestreamID) {
+			permissionsList = append(permissionsList, moderator.Permissions)
+		}
+	}
+	return permissionsList, nil
+}
+
+// appliesTo channelの任命・BANは配信者の全配信に、livestreamのものはその配信にのみ適用する
+func appliesTo(scope string, streamerID, livestreamID int64, rowStreamerID, rowLivestreamID int64) bool {
+	switch scope {
+	case "channel":
+		return rowStreamerID == streamerID
+	case "livestream":
+		return rowLivestreamID == livestreamID
+	default:
+		return false
+	}
+}
+
+func (r *memoryModeration) ListModerators(ctx context.Context, streamerID, livestreamID int64) ([]Moderator, error) {
+	moderators := filter(r.tables.moderators, func(moderator Moderator) bool {
+		return moderator.StreamerID == streamerID && appliesTo(moderator.Scope, streamerID, livestreamID, moderator.StreamerID, moderator.LivestreamID)
+	})
+	slices.SortStableFunc(moderators, func(a, b Moderator) int { return cmp.Compare(a.CreatedAt, b.CreatedAt) })
+	return moderators, nil
+}
+
+func (r *memoryModeration) UpsertModerator(ctx context.Context, moderator *Moderator) error {
+	// (streamer_id, user_id, livestream_id)はUNIQUE
+	for i := range r.tables.moderators {
+		if m := &r.tables.moderators[i]; m.StreamerID == moderator.StreamerID && m.UserID == moderator.UserID && m.LivestreamID == moderator.LivestreamID {
+			m.Permissions = moderator.Permissions
+			*moderator = *m
+			return nil
+		}
+	}
+	moderator.ID = nextID(r.tables.moderators, func(moderator Moderator) int64 { return moderator.ID })
+	r.tables.moderators = append(r.tables.moderators, *moderator)
+	return nil
+}
+
+func (r *memoryModeration) DeleteModerator(ctx context.Context, id, streamerID, livestreamID int64) (bool, error) {
+	n := len(r.tables.moderators)
+	r.tables.moderators = slices.DeleteFunc(r.tables.moderators, func(moderator Moderator) bool {
+		return moderator.ID == id && moderator.StreamerID == streamerID && appliesTo(moderator.Scope, streamerID, livestreamID, moderator.StreamerID, moderator.LivestreamID)
+	})
+	return len(r.tables.moderators) < n, nil
+}
+
+func (r *memoryModeration) DeleteLivestreamModerators(ctx context.Context, livestreamID int64) error {
+	r.tables.moderators = slices.DeleteFunc(r.tables.moderators, func(moderator Moderator) bool {
+		return moderator.Scope == "livestream" && moderator.LivestreamID == livestreamID
+	})
+	return nil
+}
+
+func (r *memoryModeration) GetNGWordForUpdate(ctx context.Context, id int64) (NGWord, error) {
+	return find(r.tables.ngWords, func(ngWord NGWord) bool { return ngWord.ID == id })
+}
+
+func (r *memoryModeration) ListNGWords(ctx context.Context, streamerID, livestreamID int64) ([]NGWord, error) {
+	ngWords := filter(r.tables.ngWords, func(ngWord NGWord) bool {
+		switch ngWord.Scope {
+		case "livestream":
+			return ngWord.UserID == streamerID && ngWord.LivestreamID == livestreamID
+		case "channel":
+			return ngWord.UserID == streamerID
+		default:
+			return ngWord.Scope == "global"
+		}
+	})
+	slices.SortStableFunc(ngWords, func(a, b NGWord) int { return cmp.Compare(b.CreatedAt, a.CreatedAt) })
+	if ngWords == nil {
+		ngWords = []NGWord{}
+	}
+	return ngWords, nil
+}
+
+func (r *memoryModeration) ListNGWordsByScope(ctx context.Context, scope string, streamerID, livestreamID int64) ([]NGWord, error) {
+	ngWords := filter(r.tables.ngWords, func(ngWord NGWord) bool {
+		switch scope {
+		case "livestream":
+			return ngWord.Scope == scope && ngWord.UserID == streamerID && ngWord.LivestreamID == livestreamID
+		case "channel":
+			return ngWord.Scope == scope && ngWord.UserID == streamerID
+		default:
+			return ngWord.Scope == scope
+		}
+	})
+	slices.SortStableFunc(ngWords, func(a, b NGWord) int { return cmp.Compare(b.CreatedAt, a.CreatedAt) })
+	if ngWords == nil {
+		ngWords = []NGWord{}
+	}
+	return ngWords, nil
+}
+
+func (r *memoryModeration) CreateNGWord(ctx context.Context, ngWord *NGWord) error {
+	ngWord.ID = nextID(r.tables.ngWords, func(ngWord NGWord) int64 { return ngWord.ID })
+	r.tables.ngWords = append(r.tables.ngWords, *ngWord)
+	return nil
+}
+
+func (r *memoryModeration) UpdateNGWord(ctx context.Context, ngWord *NGWord) error {
+	for i := range r.tables.ngWords {
+		if w := &r.tables.ngWords[i]; w.ID == ngWord.ID {
+			w.Word = ngWord.Word
+			w.MatchMode = ngWord.MatchMode
+		}
+	}
+	return nil
+}
+
+func (r *memoryModeration) DeleteNGWord(ctx context.Context, id int64) error {
+	r.tables.ngWords = slices.DeleteFunc(r.tables.ngWords, func(ngWord NGWord) bool { return ngWord.ID == id })
+	return nil
+}
+
+func (r *memoryModeration) DeleteGlobalNGWord(ctx context.Context, id int64) (bool, error) {
+	n := len(r.tables.ngWords)
+	r.tables.ngWords = slices.DeleteFunc(r.tables.ngWords, func(ngWord NGWord) bool { return ngWord.ID == id && ngWord.Scope == "global" })
+	return len(r.tables.ngWords) < n, nil
+}
+
+func (r *memoryModeration) DeleteLivestreamNGWords(ctx context.Context, livestreamID int64) error {
+	r.tables.ngWords = slices.DeleteFunc(r.tables.ngWords, func(ngWord NGWord) bool {
+		return ngWord.Scope == "livestream" && ngWord.LivestreamID == livestreamID
+	})
+	return nil
+}
+
+func (r *memoryModeration) GetModerationLogForUpdate(ctx context.Context, id int64) (ModerationLog, error) {
+	return find(r.tables.moderationLogs, func(log ModerationLog) bool { return log.ID == id })
+}
+
+func (r *memoryModeration) ListModerationLogs(ctx context.Context, livestreamID int64) ([]ModerationLog, error) {
+	logs := filter(r.tables.moderationLogs, func(log ModerationLog) bool { return log.LivestreamID == livestreamID })
+	return paginate(logs, Page{}, func(log ModerationLog) Cursor {
+		return Cursor{CreatedAt: log.CreatedAt, ID: log.ID}
+	}), nil
+}
+
+func (r *memoryModeration) CreateModerationLog(ctx context.Context, log *ModerationLog) error {
+	log.ID = nextID(r.tables.moderationLogs, func(log ModerationLog) int64 { return log.ID })
+	r.tables.moderationLogs = append(r.tables.moderationLogs, *log)
+	return nil
+}
+
+func (r *memoryModeration) RevertModerationLog(ctx context.Context, id int64, revertedAt int64) error {
+	for i := range r.tables.moderationLogs {
+		if log := &r.tables.moderationLogs[i]; log.ID == id {
+			log.RevertedAt = sql.NullInt64{Int64: revertedAt, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (r *memoryModeration) DeleteModerationLogs(ctx context.Context, livestreamID int64) error {
+	r.tables.moderationLogs = slices.DeleteFunc(r.tables.moderationLogs, func(log ModerationLog) bool { return log.LivestreamID == livestreamID })
+	return nil
+}
+
+func (r *memoryModeration) GetLivestreamSettings(ctx context.Context, livestreamID int64) (LivestreamSettings, error) {
+	return find(r.tables.settings, func(settings LivestreamSettings) bool { return settings.LivestreamID == livestreamID })
+}
+
+func (r *memoryModeration) UpsertLivestreamSettings(ctx context.Context, settings *LivestreamSettings) error {
+	r.tables.settings = slices.DeleteFunc(r.tables.settings, func(s LivestreamSettings) bool { return s.LivestreamID == settings.LivestreamID })
+	r.tables.settings = append(r.tables.settings, *settings)
+	return nil
+}
+
+func (r *memoryModeration) DeleteLivestreamSettings(ctx context.Context, livestreamID int64) error {
+	r.tables.settings = slices.DeleteFunc(r.tables.settings, func(s LivestreamSettings) bool { return s.LivestreamID == livestreamID })
+	return nil
+}
+
+func (r *memoryModeration) ListActiveBans(ctx context.Context, streamerID, livestreamID, now int64) ([]UserBan, error) {
+	bans := filter(r.tables.bans, func(ban UserBan) bool {
+		return appliesTo(ban.Scope, streamerID, livestreamID, ban.StreamerID, ban.LivestreamID) &&
+			(!ban.ExpiresAt.Valid || ban.ExpiresAt.Int64 > now)
+	})
+	slices.SortStableFunc(bans, func(a, b UserBan) int { return cmp.Compare(b.CreatedAt, a.CreatedAt) })
+	return bans, nil
+}
+
+func (r *memoryModeration) ListActiveBansForUser(ctx context.Context, userID, streamerID, livestreamID, now int64) ([]UserBan, error) {
+	bans, err := r.ListActiveBans(ctx, streamerID, livestreamID, now)
+	if err != nil {
+		return nil, err
+	}
+	return filter(bans, func(ban UserBan) bool { return ban.UserID == userID }), nil
+}
+
+func (r *memoryModeration) CreateBan(ctx context.Context, ban *UserBan) error {
+	ban.ID = nextID(r.tables.bans, func(ban UserBan) int64 { return ban.ID })
+	r.tables.bans = append(r.tables.bans, *ban)
+	return nil
+}
+
+func (r *memoryModeration) DeleteBan(ctx context.Context, id, streamerID, livestreamID int64) (bool, error) {
+	n := len(r.tables.bans)
+	r.tables.bans = slices.DeleteFunc(r.tables.bans, func(ban UserBan) bool {
+		return ban.ID == id && appliesTo(ban.Scope, streamerID, livestreamID, ban.StreamerID, ban.LivestreamID)
+	})
+	return len(r.tables.bans) < n, nil
+}
+
+func (r *memoryModeration) DeleteLivestreamBans(ctx context.Context, livestreamID int64) error {
+	r.tables.bans = slices.DeleteFunc(r.tables.bans, func(ban UserBan) bool {
+		return ban.Scope == "livestream" && ban.LivestreamID == livestreamID
+	})
+	return nil
+}
@@ -0,0 +1,159 @@
+package store
+
+import "database/sql"
+
+type User struct {
+	ID             int64  `db:"id"`
+	Name           string `db:"name"`
+	DisplayName    string `db:"display_name"`
+	Description    string `db:"description"`
+	HashedPassword string `db:"password"`
+}
+
+type Theme struct {
+	ID       int64 `db:"id"`
+	UserID   int64 `db:"user_id"`
+	DarkMode bool  `db:"dark_mode"`
+}
+
+type Livestream struct {
+	ID           int64  `db:"id" json:"id"`
+	UserID       int64  `db:"user_id" json:"user_id"`
+	Title        string `db:"title" json:"title"`
+	Description  string `db:"description" json:"description"`
+	PlaylistUrl  string `db:"playlist_url" json:"playlist_url"`
+	ThumbnailUrl string `db:"thumbnail_url" json:"thumbnail_url"`
+	StartAt      int64  `db:"start_at" json:"start_at"`
+	EndAt        int64  `db:"end_at" json:"end_at"`
+	// SeriesID 繰り返し予約で作成した場合のシリーズ
+	SeriesID sql.NullInt64 `db:"series_id" json:"series_id"`
+}
+
+type LivestreamSeries struct {
+	ID        int64  `db:"id"`
+	UserID    int64  `db:"user_id"`
+	Frequency string `db:"frequency"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+type Tag struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+type LivestreamTag struct {
+	ID           int64 `db:"id" json:"id"`
+	LivestreamID int64 `db:"livestream_id" json:"livestream_id"`
+	TagID        int64 `db:"tag_id" json:"tag_id"`
+}
+
+type LivestreamViewer struct {
+	UserID       int64 `db:"user_id" json:"user_id"`
+	LivestreamID int64 `db:"livestream_id" json:"livestream_id"`
+	CreatedAt    int64 `db:"created_at" json:"created_at"`
+}
+
+type ReservationSlot struct {
+	ID      int64 `db:"id" json:"id"`
+	Slot    int64 `db:"slot" json:"slot"`
+	StartAt int64 `db:"start_at" json:"start_at"`
+	EndAt   int64 `db:"end_at" json:"end_at"`
+}
+
+type Livecomment struct {
+	ID           int64  `db:"id"`
+	UserID       int64  `db:"user_id"`
+	LivestreamID int64  `db:"livestream_id"`
+	Comment      string `db:"comment"`
+	Tip          int64  `db:"tip"`
+	CreatedAt    int64  `db:"created_at"`
+	// モデレーションで非表示になったライブコメントは削除せずに残す
+	HiddenAt        sql.NullInt64  `db:"hidden_at"`
+	HiddenReason    sql.NullString `db:"hidden_reason"`
+	HiddenNGWordID  sql.NullInt64  `db:"hidden_ng_word_id"`
+	ModerationLogID sql.NullInt64  `db:"moderation_log_id"`
+	EditedAt        sql.NullInt64  `db:"edited_at"`
+}
+
+type LivecommentReport struct {
+	ID            int64          `db:"id"`
+	UserID        int64          `db:"user_id"`
+	LivestreamID  int64          `db:"livestream_id"`
+	LivecommentID int64          `db:"livecomment_id"`
+	CreatedAt     int64          `db:"created_at"`
+	Status        string         `db:"status"`
+	Action        sql.NullString `db:"action"`
+	ResolvedBy    sql.NullInt64  `db:"resolved_by"`
+	ResolvedAt    sql.NullInt64  `db:"resolved_at"`
+}
+
+type LivestreamPin struct {
+	LivestreamID  int64 `db:"livestream_id"`
+	LivecommentID int64 `db:"livecomment_id"`
+	PinnedBy      int64 `db:"pinned_by"`
+	PinnedAt      int64 `db:"pinned_at"`
+}
+
+type Reaction struct {
+	ID           int64  `db:"id"`
+	EmojiName    string `db:"emoji_name"`
+	UserID       int64  `db:"user_id"`
+	LivestreamID int64  `db:"livestream_id"`
+	CreatedAt    int64  `db:"created_at"`
+}
+
+type NGWord struct {
+	ID           int64  `json:"id" db:"id"`
+	UserID       int64  `json:"user_id" db:"user_id"`
+	LivestreamID int64  `json:"livestream_id" db:"livestream_id"`
+	Word         string `json:"word" db:"word"`
+	MatchMode    string `json:"match_mode" db:"match_mode"`
+	// Scope livestream, channel, global のいずれか
+	Scope     string `json:"scope" db:"scope"`
+	CreatedAt int64  `json:"created_at" db:"created_at"`
+}
+
+type Moderator struct {
+	ID         int64 `db:"id"`
+	StreamerID int64 `db:"streamer_id"`
+	UserID     int64 `db:"user_id"`
+	// LivestreamID channelの場合は0
+	LivestreamID int64  `db:"livestream_id"`
+	Scope        string `db:"scope"`
+	// Permissions カンマ区切り
+	Permissions string `db:"permissions"`
+	CreatedAt   int64  `db:"created_at"`
+}
+
+type ModerationLog struct {
+	ID           int64         `db:"id"`
+	LivestreamID int64         `db:"livestream_id"`
+	UserID       int64         `db:"user_id"`
+	NGWordID     sql.NullInt64 `db:"ng_word_id"`
+	Action       string        `db:"action"`
+	CreatedAt    int64         `db:"created_at"`
+	RevertedAt   sql.NullInt64 `db:"reverted_at"`
+}
+
+// LivestreamSettings 配信者が設定する配信ごとのモデレーション設定. 行がなければデフォルト値を使う
+type LivestreamSettings struct {
+	LivestreamID int64 `db:"livestream_id"`
+	// AutoHideReportThreshold 未対応の報告がこの数に達したライブコメントを自動で非表示にする. 0なら無効
+	AutoHideReportThreshold int64 `db:"auto_hide_report_threshold"`
+	// SlowModeSeconds 同じユーザがライブコメントを投稿できる最小間隔. 0なら無効
+	SlowModeSeconds int64 `db:"slow_mode_seconds"`
+}
+
+type UserBan struct {
+	ID     int64 `db:"id"`
+	UserID int64 `db:"user_id"`
+	// StreamerID BANした配信者. channelのBANは配信者の全配信に適用する
+	StreamerID   int64  `db:"streamer_id"`
+	LivestreamID int64  `db:"livestream_id"`
+	Scope        string `db:"scope"`
+	Reason       string `db:"reason"`
+	CreatedBy    int64  `db:"created_by"`
+	CreatedAt    int64  `db:"created_at"`
+	// ExpiresAt タイムアウトの場合の期限. NULLなら無期限
+	ExpiresAt sql.NullInt64 `db:"expires_at"`
+}
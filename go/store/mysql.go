@@ -0,0 +1,852 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// mysqlErrDupEntry 一意制約に違反したときのエラー番号
+const mysqlErrDupEntry = 1062
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDupEntry
+}
+
+type mysqlStore struct {
+	db *sqlx.DB
+}
+
+func NewMySQL(db *sqlx.DB) Store {
+	return &mysqlStore{db: db}
+}
+
+func (s *mysqlStore) Begin(ctx context.Context) (Tx, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &mysqlTx{tx: tx}, nil
+}
+
+type mysqlTx struct {
+	tx *sqlx.Tx
+}
+
+func (t *mysqlTx) Users() UserRepository               { return (*mysqlUsers)(t) }
+func (t *mysqlTx) Livestreams() LivestreamRepository   { return (*mysqlLivestreams)(t) }
+func (t *mysqlTx) Livecomments() LivecommentRepository { return (*mysqlLivecomments)(t) }
+func (t *mysqlTx) Reactions() ReactionRepository       { return (*mysqlReactions)(t) }
+func (t *mysqlTx) Reservations() ReservationRepository { return (*mysqlReservations)(t) }
+func (t *mysqlTx) Moderation() ModerationRepository    { return (*mysqlModeration)(t) }
+
+func (t *mysqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *mysqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// selectIn IN句の引数が空の場合はクエリを発行しない
+func selectIn[T any](ctx context.Context, tx *sqlx.Tx, query string, ids []int64) ([]T, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	query, params, err := sqlx.In(query, ids)
+	if err != nil {
+		return nil, err
+	}
+	var res []T
+	if err := tx.SelectContext(ctx, &res, query, params...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// buildPage WHERE句で終わるクエリにカーソル条件、並び順、LIMITを付与する
+func buildPage(query string, page Page, args ...interface{}) (string, []interface{}) {
+	switch {
+	case page.After != nil:
+		query += " AND (created_at > ? OR (created_at = ? AND id > ?)) ORDER BY created_at ASC, id ASC"
+		args = append(args, page.After.CreatedAt, page.After.CreatedAt, page.After.ID)
+	case page.Before != nil:
+		query += " AND (created_at < ? OR (created_at = ? AND id < ?)) ORDER BY created_at DESC, id DESC"
+		args = append(args, page.Before.CreatedAt, page.Before.CreatedAt, page.Before.ID)
+	default:
+		query += " ORDER BY created_at DESC, id DESC"
+	}
+	if page.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, page.Limit)
+	}
+	return query, args
+}
+
+type mysqlUsers mysqlTx
+
+func (r *mysqlUsers) GetUserByID(ctx context.Context, id int64) (User, error) {
+	var user User
+	err := r.tx.GetContext(ctx, &user, "SELECT * FROM users WHERE id = ?", id)
+	return user, err
+}
+
+func (r *mysqlUsers) GetUserByName(ctx context.Context, name string) (User, error) {
+	var user User
+	err := r.tx.GetContext(ctx, &user, "SELECT * FROM users WHERE name = ?", name)
+	return user, err
+}
+
+func (r *mysqlUsers) GetUsersByIDs(ctx context.Context, ids []int64) ([]User, error) {
+	return selectIn[User](ctx, r.tx, "SELECT * FROM users WHERE id IN (?)", ids)
+}
+
+func (r *mysqlUsers) ListUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	if err := r.tx.SelectContext(ctx, &users, "SELECT * FROM users"); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *mysqlUsers) CreateUser(ctx context.Context, user *User) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO users (name, display_name, description, password) VALUES(:name, :display_name, :description, :password)", user)
+	if err != nil {
+		return err
+	}
+	user.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlUsers) GetTheme(ctx context.Context, userID int64) (Theme, error) {
+	var theme Theme
+	err := r.tx.GetContext(ctx, &theme, "SELECT * FROM themes WHERE user_id = ?", userID)
+	return theme, err
+}
+
+func (r *mysqlUsers) GetThemesByUserIDs(ctx context.Context, userIDs []int64) ([]Theme, error) {
+	return selectIn[Theme](ctx, r.tx, "SELECT * FROM themes WHERE user_id IN (?)", userIDs)
+}
+
+func (r *mysqlUsers) CreateTheme(ctx context.Context, theme *Theme) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO themes (user_id, dark_mode) VALUES(:user_id, :dark_mode)", theme)
+	if err != nil {
+		return err
+	}
+	theme.ID, err = result.LastInsertId()
+	return err
+}
+
+type mysqlLivestreams mysqlTx
+
+func (r *mysqlLivestreams) GetLivestreamByID(ctx context.Context, id int64) (Livestream, error) {
+	var livestream Livestream
+	err := r.tx.GetContext(ctx, &livestream, "SELECT * FROM livestreams WHERE id = ?", id)
+	return livestream, err
+}
+
+func (r *mysqlLivestreams) GetLivestreamByIDForUpdate(ctx context.Context, id int64) (Livestream, error) {
+	var livestream Livestream
+	err := r.tx.GetContext(ctx, &livestream, "SELECT * FROM livestreams WHERE id = ? FOR UPDATE", id)
+	return livestream, err
+}
+
+func (r *mysqlLivestreams) GetLivestreamsByIDs(ctx context.Context, ids []int64) ([]Livestream, error) {
+	return selectIn[Livestream](ctx, r.tx, "SELECT * FROM livestreams WHERE id IN (?) ORDER BY id DESC", ids)
+}
+
+func (r *mysqlLivestreams) GetLivestreamsByUserID(ctx context.Context, userID int64) ([]Livestream, error) {
+	var livestreams []Livestream
+	if err := r.tx.SelectContext(ctx, &livestreams, "SELECT * FROM livestreams WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	return livestreams, nil
+}
+
+func (r *mysqlLivestreams) ListLivestreams(ctx context.Context, limit int) ([]Livestream, error) {
+	query := "SELECT * FROM livestreams ORDER BY id DESC"
+	args := []interface{}{}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	var livestreams []Livestream
+	if err := r.tx.SelectContext(ctx, &livestreams, query, args...); err != nil {
+		return nil, err
+	}
+	return livestreams, nil
+}
+
+func (r *mysqlLivestreams) CreateLivestream(ctx context.Context, livestream *Livestream) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO livestreams (user_id, title, description, playlist_url, thumbnail_url, start_at, end_at, series_id) VALUES(:user_id, :title, :description, :playlist_url, :thumbnail_url, :start_at, :end_at, :series_id)", livestream)
+	if err != nil {
+		return err
+	}
+	livestream.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlLivestreams) UpdateLivestream(ctx context.Context, livestream *Livestream) error {
+	_, err := r.tx.NamedExecContext(ctx, "UPDATE livestreams SET title = :title, description = :description, playlist_url = :playlist_url, thumbnail_url = :thumbnail_url, start_at = :start_at, end_at = :end_at WHERE id = :id", livestream)
+	return err
+}
+
+func (r *mysqlLivestreams) DeleteLivestream(ctx context.Context, id int64) (bool, error) {
+	result, err := r.tx.ExecContext(ctx, "DELETE FROM livestreams WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *mysqlLivestreams) GetSeriesByID(ctx context.Context, id int64) (LivestreamSeries, error) {
+	var series LivestreamSeries
+	err := r.tx.GetContext(ctx, &series, "SELECT * FROM livestream_series WHERE id = ?", id)
+	return series, err
+}
+
+func (r *mysqlLivestreams) CreateSeries(ctx context.Context, series *LivestreamSeries) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO livestream_series (user_id, frequency, created_at) VALUES (:user_id, :frequency, :created_at)", series)
+	if err != nil {
+		return err
+	}
+	series.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlLivestreams) GetLivestreamsBySeriesID(ctx context.Context, seriesID int64) ([]Livestream, error) {
+	var livestreams []Livestream
+	if err := r.tx.SelectContext(ctx, &livestreams, "SELECT * FROM livestreams WHERE series_id = ? ORDER BY start_at", seriesID); err != nil {
+		return nil, err
+	}
+	return livestreams, nil
+}
+
+func (r *mysqlLivestreams) GetTags(ctx context.Context) ([]Tag, error) {
+	var tags []Tag
+	if err := r.tx.SelectContext(ctx, &tags, "SELECT * FROM tags"); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (r *mysqlLivestreams) GetTagsByIDs(ctx context.Context, ids []int64) ([]Tag, error) {
+	return selectIn[Tag](ctx, r.tx, "SELECT * FROM tags WHERE id IN (?)", ids)
+}
+
+func (r *mysqlLivestreams) GetTagIDsByName(ctx context.Context, name string) ([]int64, error) {
+	var ids []int64
+	if err := r.tx.SelectContext(ctx, &ids, "SELECT id FROM tags WHERE name = ?", name); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *mysqlLivestreams) GetLivestreamTagsByLivestreamIDs(ctx context.Context, livestreamIDs []int64) ([]LivestreamTag, error) {
+	return selectIn[LivestreamTag](ctx, r.tx, "SELECT * FROM livestream_tags WHERE livestream_id IN (?) ORDER BY id", livestreamIDs)
+}
+
+func (r *mysqlLivestreams) GetLivestreamTagsByTagIDs(ctx context.Context, tagIDs []int64) ([]LivestreamTag, error) {
+	return selectIn[LivestreamTag](ctx, r.tx, "SELECT * FROM livestream_tags WHERE tag_id IN (?) ORDER BY livestream_id DESC", tagIDs)
+}
+
+func (r *mysqlLivestreams) CreateLivestreamTag(ctx context.Context, livestreamTag *LivestreamTag) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO livestream_tags (livestream_id, tag_id) VALUES (:livestream_id, :tag_id)", livestreamTag)
+	if err != nil {
+		return err
+	}
+	livestreamTag.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlLivestreams) DeleteLivestreamTags(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM livestream_tags WHERE livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlLivestreams) CreateViewer(ctx context.Context, viewer *LivestreamViewer) error {
+	_, err := r.tx.NamedExecContext(ctx, "INSERT INTO livestream_viewers_history (user_id, livestream_id, created_at) VALUES(:user_id, :livestream_id, :created_at)", viewer)
+	return err
+}
+
+func (r *mysqlLivestreams) DeleteViewer(ctx context.Context, userID, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM livestream_viewers_history WHERE user_id = ? AND livestream_id = ?", userID, livestreamID)
+	return err
+}
+
+func (r *mysqlLivestreams) DeleteViewers(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM livestream_viewers_history WHERE livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlLivestreams) CountViewers(ctx context.Context, livestreamID int64) (int64, error) {
+	var count int64
+	err := r.tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM livestream_viewers_history WHERE livestream_id = ?", livestreamID)
+	return count, err
+}
+
+type mysqlLivecomments mysqlTx
+
+func (r *mysqlLivecomments) GetLivecommentByID(ctx context.Context, id int64) (Livecomment, error) {
+	var livecomment Livecomment
+	err := r.tx.GetContext(ctx, &livecomment, "SELECT * FROM livecomments WHERE id = ?", id)
+	return livecomment, err
+}
+
+func (r *mysqlLivecomments) GetLivecommentsByIDs(ctx context.Context, ids []int64) ([]Livecomment, error) {
+	return selectIn[Livecomment](ctx, r.tx, "SELECT * FROM livecomments WHERE id IN (?)", ids)
+}
+
+func (r *mysqlLivecomments) GetLivecommentForUpdate(ctx context.Context, id int64) (Livecomment, error) {
+	var livecomment Livecomment
+	err := r.tx.GetContext(ctx, &livecomment, "SELECT * FROM livecomments WHERE id = ? FOR UPDATE", id)
+	return livecomment, err
+}
+
+func (r *mysqlLivecomments) selectLivecomments(ctx context.Context, query string, args ...interface{}) ([]Livecomment, error) {
+	var livecomments []Livecomment
+	if err := r.tx.SelectContext(ctx, &livecomments, query, args...); err != nil {
+		return nil, err
+	}
+	return livecomments, nil
+}
+
+func (r *mysqlLivecomments) ListLivecomments(ctx context.Context, livestreamID int64) ([]Livecomment, error) {
+	return r.selectLivecomments(ctx, "SELECT * FROM livecomments WHERE livestream_id = ?", livestreamID)
+}
+
+func (r *mysqlLivecomments) ListVisibleLivecomments(ctx context.Context, livestreamID int64, page Page) ([]Livecomment, error) {
+	query, args := buildPage("SELECT * FROM livecomments WHERE livestream_id = ? AND hidden_at IS NULL", page, livestreamID)
+	livecomments := []Livecomment{}
+	if err := r.tx.SelectContext(ctx, &livecomments, query, args...); err != nil {
+		return nil, err
+	}
+	return livecomments, nil
+}
+
+func (r *mysqlLivecomments) ListVisibleLivecommentsAfter(ctx context.Context, livestreamID, afterID int64) ([]Livecomment, error) {
+	return r.selectLivecomments(ctx, "SELECT * FROM livecomments WHERE livestream_id = ? AND id > ? AND hidden_at IS NULL ORDER BY id", livestreamID, afterID)
+}
+
+func (r *mysqlLivecomments) ListVisibleTippedLivecomments(ctx context.Context, livestreamID, since int64) ([]Livecomment, error) {
+	return r.selectLivecomments(ctx, "SELECT * FROM livecomments WHERE livestream_id = ? AND tip > 0 AND created_at >= ? AND hidden_at IS NULL", livestreamID, since)
+}
+
+func (r *mysqlLivecomments) ListUnmoderatedLivecomments(ctx context.Context, livestreamID int64) ([]Livecomment, error) {
+	return r.selectLivecomments(ctx, "SELECT * FROM livecomments WHERE livestream_id = ? AND hidden_at IS NULL AND moderation_log_id IS NULL", livestreamID)
+}
+
+func (r *mysqlLivecomments) ListLivecommentsByModerationLogID(ctx context.Context, moderationLogID int64) ([]Livecomment, error) {
+	return r.selectLivecomments(ctx, "SELECT * FROM livecomments WHERE moderation_log_id = ? ORDER BY id", moderationLogID)
+}
+
+func (r *mysqlLivecomments) CreateLivecomment(ctx context.Context, livecomment *Livecomment) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO livecomments (user_id, livestream_id, comment, tip, created_at) VALUES (:user_id, :livestream_id, :comment, :tip, :created_at)", livecomment)
+	if err != nil {
+		return err
+	}
+	livecomment.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlLivecomments) UpdateLivecomment(ctx context.Context, livecomment *Livecomment) error {
+	_, err := r.tx.NamedExecContext(ctx, "UPDATE livecomments SET comment = :comment, edited_at = :edited_at WHERE id = :id", livecomment)
+	return err
+}
+
+func (r *mysqlLivecomments) HideLivecomments(ctx context.Context, ids []int64, hiddenAt int64, reason string, ngWordID sql.NullInt64, moderationLogID int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, params, err := sqlx.In("UPDATE livecomments SET hidden_at = ?, hidden_reason = ?, hidden_ng_word_id = ?, moderation_log_id = ? WHERE id IN (?)", hiddenAt, reason, ngWordID, moderationLogID, ids)
+	if err != nil {
+		return err
+	}
+	_, err = r.tx.ExecContext(ctx, query, params...)
+	return err
+}
+
+func (r *mysqlLivecomments) HideLivecommentByAuthor(ctx context.Context, id int64, hiddenAt int64, reason string) error {
+	_, err := r.tx.ExecContext(ctx, "UPDATE livecomments SET hidden_at = ?, hidden_reason = ? WHERE id = ?", hiddenAt, reason, id)
+	return err
+}
+
+func (r *mysqlLivecomments) RestoreLivecomment(ctx context.Context, id int64) error {
+	_, err := r.tx.ExecContext(ctx, "UPDATE livecomments SET hidden_at = NULL WHERE id = ?", id)
+	return err
+}
+
+func (r *mysqlLivecomments) RestoreLivecommentsByModerationLogID(ctx context.Context, moderationLogID int64) error {
+	_, err := r.tx.ExecContext(ctx, "UPDATE livecomments SET hidden_at = NULL WHERE moderation_log_id = ?", moderationLogID)
+	return err
+}
+
+func (r *mysqlLivecomments) DeleteLivecomments(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM livecomments WHERE livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlLivecomments) GetTotalTip(ctx context.Context) (int64, error) {
+	var total int64
+	err := r.tx.GetContext(ctx, &total, "SELECT IFNULL(SUM(tip), 0) FROM livecomments")
+	return total, err
+}
+
+func (r *mysqlLivecomments) GetTipStats(ctx context.Context, livestreamID int64) (int64, int64, error) {
+	var stats struct {
+		Total int64 `db:"total"`
+		Max   int64 `db:"max"`
+	}
+	err := r.tx.GetContext(ctx, &stats, "SELECT IFNULL(SUM(tip), 0) AS total, IFNULL(MAX(tip), 0) AS max FROM livecomments WHERE livestream_id = ?", livestreamID)
+	return stats.Total, stats.Max, err
+}
+
+func (r *mysqlLivecomments) GetPinsByLivestreamIDs(ctx context.Context, livestreamIDs []int64) ([]LivestreamPin, error) {
+	return selectIn[LivestreamPin](ctx, r.tx, "SELECT * FROM livestream_pins WHERE livestream_id IN (?)", livestreamIDs)
+}
+
+func (r *mysqlLivecomments) UpsertPin(ctx context.Context, pin *LivestreamPin) error {
+	query := `
+	INSERT INTO livestream_pins (livestream_id, livecomment_id, pinned_by, pinned_at)
+	VALUES (:livestream_id, :livecomment_id, :pinned_by, :pinned_at)
+	ON DUPLICATE KEY UPDATE
+	livecomment_id = VALUES(livecomment_id), pinned_by = VALUES(pinned_by), pinned_at = VALUES(pinned_at)
+	`
+	_, err := r.tx.NamedExecContext(ctx, query, pin)
+	return err
+}
+
+func (r *mysqlLivecomments) DeletePin(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM livestream_pins WHERE livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlLivecomments) GetReportByID(ctx context.Context, id int64) (LivecommentReport, error) {
+	var report LivecommentReport
+	err := r.tx.GetContext(ctx, &report, "SELECT * FROM livecomment_reports WHERE id = ?", id)
+	return report, err
+}
+
+func (r *mysqlLivecomments) GetReportForUpdate(ctx context.Context, id int64) (LivecommentReport, error) {
+	var report LivecommentReport
+	err := r.tx.GetContext(ctx, &report, "SELECT * FROM livecomment_reports WHERE id = ? FOR UPDATE", id)
+	return report, err
+}
+
+func (r *mysqlLivecomments) ListReports(ctx context.Context, livestreamID int64, status string) ([]LivecommentReport, error) {
+	query := "SELECT * FROM livecomment_reports WHERE livestream_id = ?"
+	args := []interface{}{livestreamID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	var reports []LivecommentReport
+	if err := r.tx.SelectContext(ctx, &reports, query, args...); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (r *mysqlLivecomments) CountOpenReporters(ctx context.Context, livecommentID int64) (int64, error) {
+	var count int64
+	err := r.tx.GetContext(ctx, &count, "SELECT COUNT(DISTINCT user_id) FROM livecomment_reports WHERE livecomment_id = ? AND status = 'open'", livecommentID)
+	return count, err
+}
+
+func (r *mysqlLivecomments) CreateReport(ctx context.Context, report *LivecommentReport) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO livecomment_reports(user_id, livestream_id, livecomment_id, created_at, status) VALUES (:user_id, :livestream_id, :livecomment_id, :created_at, :status)", report)
+	if isDuplicateEntry(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	report.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlLivecomments) ResolveReports(ctx context.Context, livecommentID int64, status, action string, resolvedBy, resolvedAt int64) error {
+	_, err := r.tx.ExecContext(ctx, "UPDATE livecomment_reports SET status = ?, action = ?, resolved_by = ?, resolved_at = ? WHERE livecomment_id = ? AND status = 'open'", status, action, resolvedBy, resolvedAt, livecommentID)
+	return err
+}
+
+func (r *mysqlLivecomments) DeleteReports(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM livecomment_reports WHERE livestream_id = ?", livestreamID)
+	return err
+}
+
+type mysqlReactions mysqlTx
+
+func (r *mysqlReactions) ListReactions(ctx context.Context, livestreamID int64, page Page) ([]Reaction, error) {
+	query, args := buildPage("SELECT * FROM reactions WHERE livestream_id = ?", page, livestreamID)
+	reactions := []Reaction{}
+	if err := r.tx.SelectContext(ctx, &reactions, query, args...); err != nil {
+		return nil, err
+	}
+	return reactions, nil
+}
+
+func (r *mysqlReactions) CreateReaction(ctx context.Context, reaction *Reaction) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO reactions (user_id, livestream_id, emoji_name, created_at) VALUES (:user_id, :livestream_id, :emoji_name, :created_at)", reaction)
+	if err != nil {
+		return err
+	}
+	reaction.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlReactions) DeleteReactions(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM reactions WHERE livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlReactions) CountReactions(ctx context.Context, livestreamID int64) (int64, error) {
+	var count int64
+	err := r.tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM reactions WHERE livestream_id = ?", livestreamID)
+	return count, err
+}
+
+func (r *mysqlReactions) CountReactionsByStreamerID(ctx context.Context, streamerID int64) (int64, error) {
+	var count int64
+	query := `
+	SELECT COUNT(*)
+	FROM livestreams l
+	INNER JOIN reactions r ON r.livestream_id = l.id
+	WHERE l.user_id = ?
+	`
+	err := r.tx.GetContext(ctx, &count, query, streamerID)
+	return count, err
+}
+
+func (r *mysqlReactions) GetFavoriteEmoji(ctx context.Context, streamerID int64) (string, error) {
+	var emojiName string
+	query := `
+	SELECT r.emoji_name
+	FROM livestreams l
+	INNER JOIN reactions r ON r.livestream_id = l.id
+	WHERE l.user_id = ?
+	GROUP BY emoji_name
+	ORDER BY COUNT(*) DESC, emoji_name DESC
+	LIMIT 1
+	`
+	if err := r.tx.GetContext(ctx, &emojiName, query, streamerID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return emojiName, nil
+}
+
+type mysqlReservations mysqlTx
+
+func (r *mysqlReservations) ListSlots(ctx context.Context, startAt, endAt int64) ([]ReservationSlot, error) {
+	slots := []ReservationSlot{}
+	if err := r.tx.SelectContext(ctx, &slots, "SELECT * FROM reservation_slots WHERE start_at >= ? AND end_at <= ? ORDER BY start_at", startAt, endAt); err != nil {
+		return nil, err
+	}
+	return slots, nil
+}
+
+// overlappingSlotsFrom startAtを含む予約枠の開始時刻. 重なる予約枠をstart_atのインデックスの範囲で探すための下限にする
+func (r *mysqlReservations) overlappingSlotsFrom(ctx context.Context, startAt int64) (int64, error) {
+	var from int64
+	err := r.tx.GetContext(ctx, &from, "SELECT COALESCE(MAX(start_at), ?) FROM reservation_slots WHERE start_at <= ?", startAt, startAt)
+	return from, err
+}
+
+func (r *mysqlReservations) GetSlotsForUpdate(ctx context.Context, startAt, endAt int64) ([]ReservationSlot, error) {
+	from, err := r.overlappingSlotsFrom(ctx, startAt)
+	if err != nil {
+		return nil, err
+	}
+	var slots []ReservationSlot
+	if err := r.tx.SelectContext(ctx, &slots, "SELECT * FROM reservation_slots WHERE start_at >= ? AND start_at < ? AND end_at > ? FOR UPDATE", from, endAt, startAt); err != nil {
+		return nil, err
+	}
+	return slots, nil
+}
+
+func (r *mysqlReservations) DecrementSlots(ctx context.Context, startAt, endAt int64) error {
+	from, err := r.overlappingSlotsFrom(ctx, startAt)
+	if err != nil {
+		return err
+	}
+	_, err = r.tx.ExecContext(ctx, "UPDATE reservation_slots SET slot = slot - 1 WHERE start_at >= ? AND start_at < ? AND end_at > ?", from, endAt, startAt)
+	return err
+}
+
+func (r *mysqlReservations) IncrementSlots(ctx context.Context, startAt, endAt int64) error {
+	from, err := r.overlappingSlotsFrom(ctx, startAt)
+	if err != nil {
+		return err
+	}
+	_, err = r.tx.ExecContext(ctx, "UPDATE reservation_slots SET slot = slot + 1 WHERE start_at >= ? AND start_at < ? AND end_at > ?", from, endAt, startAt)
+	return err
+}
+
+func (r *mysqlReservations) GetLastSlot(ctx context.Context) (ReservationSlot, error) {
+	var slot ReservationSlot
+	err := r.tx.GetContext(ctx, &slot, "SELECT * FROM reservation_slots ORDER BY end_at DESC LIMIT 1")
+	return slot, err
+}
+
+// reservationSlotsBatchSize 1年分を1文で入れるとmax_allowed_packetを超えうるので分割する
+const reservationSlotsBatchSize = 1000
+
+func (r *mysqlReservations) CreateSlots(ctx context.Context, slots []ReservationSlot) error {
+	for len(slots) > 0 {
+		batch := slots[:min(len(slots), reservationSlotsBatchSize)]
+		slots = slots[len(batch):]
+		if _, err := r.tx.NamedExecContext(ctx, "INSERT INTO reservation_slots (slot, start_at, end_at) VALUES (:slot, :start_at, :end_at)", batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type mysqlModeration mysqlTx
+
+func (r *mysqlModeration) GetModeratorPermissions(ctx context.Context, streamerID, livestreamID, userID int64) ([]string, error) {
+	var permissionsList []string
+	query := `
+	SELECT permissions FROM moderators
+	WHERE streamer_id = ? AND user_id = ? AND (scope = 'channel' OR (scope = 'livestream' AND livestream_id = ?))
+	`
+	if err := r.tx.SelectContext(ctx, &permissionsList, query, streamerID, userID, livestreamID); err != nil {
+		return nil, err
+	}
+	return permissionsList, nil
+}
+
+func (r *mysqlModeration) ListModerators(ctx context.Context, streamerID, livestreamID int64) ([]Moderator, error) {
+	var moderators []Moderator
+	query := `
+	SELECT * FROM moderators
+	WHERE streamer_id = ? AND (scope = 'channel' OR (scope = 'livestream' AND livestream_id = ?))
+	ORDER BY created_at
+	`
+	if err := r.tx.SelectContext(ctx, &moderators, query, streamerID, livestreamID); err != nil {
+		return nil, err
+	}
+	return moderators, nil
+}
+
+func (r *mysqlModeration) UpsertModerator(ctx context.Context, moderator *Moderator) error {
+	query := `
+	INSERT INTO moderators (streamer_id, user_id, livestream_id, scope, permissions, created_at)
+	VALUES (:streamer_id, :user_id, :livestream_id, :scope, :permissions, :created_at)
+	ON DUPLICATE KEY UPDATE permissions = VALUES(permissions)
+	`
+	if _, err := r.tx.NamedExecContext(ctx, query, moderator); err != nil {
+		return err
+	}
+	return r.tx.GetContext(ctx, moderator, "SELECT * FROM moderators WHERE streamer_id = ? AND user_id = ? AND livestream_id = ?", moderator.StreamerID, moderator.UserID, moderator.LivestreamID)
+}
+
+func (r *mysqlModeration) DeleteModerator(ctx context.Context, id, streamerID, livestreamID int64) (bool, error) {
+	query := `
+	DELETE FROM moderators
+	WHERE id = ? AND streamer_id = ? AND (scope = 'channel' OR (scope = 'livestream' AND livestream_id = ?))
+	`
+	result, err := r.tx.ExecContext(ctx, query, id, streamerID, livestreamID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *mysqlModeration) DeleteLivestreamModerators(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM moderators WHERE scope = 'livestream' AND livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlModeration) GetNGWordForUpdate(ctx context.Context, id int64) (NGWord, error) {
+	var ngWord NGWord
+	err := r.tx.GetContext(ctx, &ngWord, "SELECT * FROM ng_words WHERE id = ? FOR UPDATE", id)
+	return ngWord, err
+}
+
+func (r *mysqlModeration) ListNGWords(ctx context.Context, streamerID, livestreamID int64) ([]NGWord, error) {
+	ngWords := []NGWord{}
+	query := `
+	SELECT * FROM ng_words
+	WHERE
+	(scope = 'livestream' AND user_id = ? AND livestream_id = ?) OR
+	(scope = 'channel' AND user_id = ?) OR
+	scope = 'global'
+	ORDER BY created_at DESC
+	`
+	if err := r.tx.SelectContext(ctx, &ngWords, query, streamerID, livestreamID, streamerID); err != nil {
+		return nil, err
+	}
+	return ngWords, nil
+}
+
+func (r *mysqlModeration) ListNGWordsByScope(ctx context.Context, scope string, streamerID, livestreamID int64) ([]NGWord, error) {
+	ngWords := []NGWord{}
+	var err error
+	switch scope {
+	case "livestream":
+		err = r.tx.SelectContext(ctx, &ngWords, "SELECT * FROM ng_words WHERE scope = 'livestream' AND user_id = ? AND livestream_id = ? ORDER BY created_at DESC", streamerID, livestreamID)
+	case "channel":
+		err = r.tx.SelectContext(ctx, &ngWords, "SELECT * FROM ng_words WHERE scope = 'channel' AND user_id = ? ORDER BY created_at DESC", streamerID)
+	default:
+		err = r.tx.SelectContext(ctx, &ngWords, "SELECT * FROM ng_words WHERE scope = ? ORDER BY created_at DESC", scope)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ngWords, nil
+}
+
+func (r *mysqlModeration) CreateNGWord(ctx context.Context, ngWord *NGWord) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO ng_words(user_id, livestream_id, word, match_mode, scope, created_at) VALUES (:user_id, :livestream_id, :word, :match_mode, :scope, :created_at)", ngWord)
+	if err != nil {
+		return err
+	}
+	ngWord.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlModeration) UpdateNGWord(ctx context.Context, ngWord *NGWord) error {
+	_, err := r.tx.NamedExecContext(ctx, "UPDATE ng_words SET word = :word, match_mode = :match_mode WHERE id = :id", ngWord)
+	return err
+}
+
+func (r *mysqlModeration) DeleteNGWord(ctx context.Context, id int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM ng_words WHERE id = ?", id)
+	return err
+}
+
+func (r *mysqlModeration) DeleteGlobalNGWord(ctx context.Context, id int64) (bool, error) {
+	result, err := r.tx.ExecContext(ctx, "DELETE FROM ng_words WHERE id = ? AND scope = 'global'", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *mysqlModeration) DeleteLivestreamNGWords(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM ng_words WHERE scope = 'livestream' AND livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlModeration) GetModerationLogForUpdate(ctx context.Context, id int64) (ModerationLog, error) {
+	var log ModerationLog
+	err := r.tx.GetContext(ctx, &log, "SELECT * FROM moderation_logs WHERE id = ? FOR UPDATE", id)
+	return log, err
+}
+
+func (r *mysqlModeration) ListModerationLogs(ctx context.Context, livestreamID int64) ([]ModerationLog, error) {
+	var logs []ModerationLog
+	if err := r.tx.SelectContext(ctx, &logs, "SELECT * FROM moderation_logs WHERE livestream_id = ? ORDER BY created_at DESC, id DESC", livestreamID); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func (r *mysqlModeration) CreateModerationLog(ctx context.Context, log *ModerationLog) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO moderation_logs (livestream_id, user_id, ng_word_id, action, created_at) VALUES (:livestream_id, :user_id, :ng_word_id, :action, :created_at)", log)
+	if err != nil {
+		return err
+	}
+	log.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlModeration) RevertModerationLog(ctx context.Context, id int64, revertedAt int64) error {
+	_, err := r.tx.ExecContext(ctx, "UPDATE moderation_logs SET reverted_at = ? WHERE id = ?", revertedAt, id)
+	return err
+}
+
+func (r *mysqlModeration) DeleteModerationLogs(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM moderation_logs WHERE livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlModeration) GetLivestreamSettings(ctx context.Context, livestreamID int64) (LivestreamSettings, error) {
+	var settings LivestreamSettings
+	err := r.tx.GetContext(ctx, &settings, "SELECT * FROM livestream_settings WHERE livestream_id = ?", livestreamID)
+	return settings, err
+}
+
+func (r *mysqlModeration) UpsertLivestreamSettings(ctx context.Context, settings *LivestreamSettings) error {
+	query := `
+	INSERT INTO livestream_settings (livestream_id, auto_hide_report_threshold, slow_mode_seconds)
+	VALUES (:livestream_id, :auto_hide_report_threshold, :slow_mode_seconds)
+	ON DUPLICATE KEY UPDATE
+	auto_hide_report_threshold = VALUES(auto_hide_report_threshold),
+	slow_mode_seconds = VALUES(slow_mode_seconds)
+	`
+	_, err := r.tx.NamedExecContext(ctx, query, settings)
+	return err
+}
+
+func (r *mysqlModeration) DeleteLivestreamSettings(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM livestream_settings WHERE livestream_id = ?", livestreamID)
+	return err
+}
+
+func (r *mysqlModeration) ListActiveBans(ctx context.Context, streamerID, livestreamID, now int64) ([]UserBan, error) {
+	var bans []UserBan
+	query := `
+	SELECT * FROM user_bans
+	WHERE
+	((scope = 'livestream' AND livestream_id = ?) OR (scope = 'channel' AND streamer_id = ?)) AND
+	(expires_at IS NULL OR expires_at > ?)
+	ORDER BY created_at DESC
+	`
+	if err := r.tx.SelectContext(ctx, &bans, query, livestreamID, streamerID, now); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+func (r *mysqlModeration) ListActiveBansForUser(ctx context.Context, userID, streamerID, livestreamID, now int64) ([]UserBan, error) {
+	var bans []UserBan
+	query := `
+	SELECT * FROM user_bans
+	WHERE
+	user_id = ? AND
+	((scope = 'livestream' AND livestream_id = ?) OR (scope = 'channel' AND streamer_id = ?)) AND
+	(expires_at IS NULL OR expires_at > ?)
+	`
+	if err := r.tx.SelectContext(ctx, &bans, query, userID, livestreamID, streamerID, now); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+func (r *mysqlModeration) CreateBan(ctx context.Context, ban *UserBan) error {
+	result, err := r.tx.NamedExecContext(ctx, "INSERT INTO user_bans (user_id, streamer_id, livestream_id, scope, reason, created_by, created_at, expires_at) VALUES (:user_id, :streamer_id, :livestream_id, :scope, :reason, :created_by, :created_at, :expires_at)", ban)
+	if err != nil {
+		return err
+	}
+	ban.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mysqlModeration) DeleteBan(ctx context.Context, id, streamerID, livestreamID int64) (bool, error) {
+	query := `
+	DELETE FROM user_bans
+	WHERE
+	id = ? AND
+	((scope = 'livestream' AND livestream_id = ?) OR (scope = 'channel' AND streamer_id = ?))
+	`
+	result, err := r.tx.ExecContext(ctx, query, id, livestreamID, streamerID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *mysqlModeration) DeleteLivestreamBans(ctx context.Context, livestreamID int64) error {
+	_, err := r.tx.ExecContext(ctx, "DELETE FROM user_bans WHERE scope = 'livestream' AND livestream_id = ?", livestreamID)
+	return err
+}
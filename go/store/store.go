@@ -0,0 +1,235 @@
+// Package store ハンドラからデータの保存先を切り離すためのリポジトリ.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrNotFound 既存のハンドラがsql.ErrNoRowsで判定しているので同じ値にしている
+var ErrNotFound = sql.ErrNoRows
+
+// ErrDuplicate 一意制約に違反した
+var ErrDuplicate = errors.New("store: duplicate entry")
+
+// Store トランザクションを開始する
+type Store interface {
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Tx トランザクション内で使うリポジトリをまとめたもの.
+// Commitしていなければ、Rollbackは何度呼んでもよい
+type Tx interface {
+	Users() UserRepository
+	Livestreams() LivestreamRepository
+	Livecomments() LivecommentRepository
+	Reactions() ReactionRepository
+	Reservations() ReservationRepository
+	Moderation() ModerationRepository
+
+	Commit() error
+	Rollback() error
+}
+
+// Cursor (created_at, id) の組でページの境界を表す
+type Cursor struct {
+	CreatedAt int64
+	ID        int64
+}
+
+// Page 新しい順に並んだ一覧の取得範囲.
+// Afterを指定した場合は古い順で返すので、呼び出し側で並べ直すこと
+type Page struct {
+	// Limit 0なら全件
+	Limit  int
+	Before *Cursor
+	After  *Cursor
+}
+
+type UserRepository interface {
+	GetUserByID(ctx context.Context, id int64) (User, error)
+	GetUserByName(ctx context.Context, name string) (User, error)
+	GetUsersByIDs(ctx context.Context, ids []int64) ([]User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	// CreateUser 採番したIDをuser.IDに設定する
+	CreateUser(ctx context.Context, user *User) error
+
+	GetTheme(ctx context.Context, userID int64) (Theme, error)
+	GetThemesByUserIDs(ctx context.Context, userIDs []int64) ([]Theme, error)
+	CreateTheme(ctx context.Context, theme *Theme) error
+}
+
+type LivestreamRepository interface {
+	GetLivestreamByID(ctx context.Context, id int64) (Livestream, error)
+	// GetLivestreamByIDForUpdate 変更や取り消しが競合しないよう、配信をロックして返す
+	GetLivestreamByIDForUpdate(ctx context.Context, id int64) (Livestream, error)
+	// GetLivestreamsByIDs 新しい順に返す
+	GetLivestreamsByIDs(ctx context.Context, ids []int64) ([]Livestream, error)
+	GetLivestreamsByUserID(ctx context.Context, userID int64) ([]Livestream, error)
+	// ListLivestreams 新しい順に返す. limitが0なら全件
+	ListLivestreams(ctx context.Context, limit int) ([]Livestream, error)
+	// CreateLivestream 採番したIDをlivestream.IDに設定する
+	CreateLivestream(ctx context.Context, livestream *Livestream) error
+	UpdateLivestream(ctx context.Context, livestream *Livestream) error
+	// DeleteLivestream 既に削除されていた場合はfalseを返す
+	DeleteLivestream(ctx context.Context, id int64) (bool, error)
+
+	GetSeriesByID(ctx context.Context, id int64) (LivestreamSeries, error)
+	// CreateSeries 採番したIDをseries.IDに設定する
+	CreateSeries(ctx context.Context, series *LivestreamSeries) error
+	// GetLivestreamsBySeriesID 開始時刻の順に返す
+	GetLivestreamsBySeriesID(ctx context.Context, seriesID int64) ([]Livestream, error)
+
+	GetTags(ctx context.Context) ([]Tag, error)
+	GetTagsByIDs(ctx context.Context, ids []int64) ([]Tag, error)
+	GetTagIDsByName(ctx context.Context, name string) ([]int64, error)
+	GetLivestreamTagsByLivestreamIDs(ctx context.Context, livestreamIDs []int64) ([]LivestreamTag, error)
+	// GetLivestreamTagsByTagIDs 配信の新しい順に返す
+	GetLivestreamTagsByTagIDs(ctx context.Context, tagIDs []int64) ([]LivestreamTag, error)
+	CreateLivestreamTag(ctx context.Context, livestreamTag *LivestreamTag) error
+	DeleteLivestreamTags(ctx context.Context, livestreamID int64) error
+
+	CreateViewer(ctx context.Context, viewer *LivestreamViewer) error
+	DeleteViewer(ctx context.Context, userID, livestreamID int64) error
+	// DeleteViewers 配信の視聴履歴を全て削除する
+	DeleteViewers(ctx context.Context, livestreamID int64) error
+	CountViewers(ctx context.Context, livestreamID int64) (int64, error)
+}
+
+type LivecommentRepository interface {
+	GetLivecommentByID(ctx context.Context, id int64) (Livecomment, error)
+	GetLivecommentsByIDs(ctx context.Context, ids []int64) ([]Livecomment, error)
+	// GetLivecommentForUpdate 編集やモデレーションが競合しないよう、ライブコメントをロックして返す
+	GetLivecommentForUpdate(ctx context.Context, id int64) (Livecomment, error)
+	// ListLivecomments 非表示のものも含めて配信の全てのライブコメントを返す
+	ListLivecomments(ctx context.Context, livestreamID int64) ([]Livecomment, error)
+	// ListVisibleLivecomments 非表示になっていないライブコメントを返す
+	ListVisibleLivecomments(ctx context.Context, livestreamID int64, page Page) ([]Livecomment, error)
+	// ListVisibleLivecommentsAfter idがafterIDより大きい、非表示になっていないライブコメントをidの順に返す
+	ListVisibleLivecommentsAfter(ctx context.Context, livestreamID, afterID int64) ([]Livecomment, error)
+	// ListVisibleTippedLivecomments since以降に投稿された、非表示になっていないチップ付きのライブコメントを返す
+	ListVisibleTippedLivecomments(ctx context.Context, livestreamID, since int64) ([]Livecomment, error)
+	// ListUnmoderatedLivecomments 非表示になっておらず、モデレーション操作の対象になったこともないライブコメントを返す
+	ListUnmoderatedLivecomments(ctx context.Context, livestreamID int64) ([]Livecomment, error)
+	// ListLivecommentsByModerationLogID モデレーション操作の対象になったライブコメントをidの順に返す
+	ListLivecommentsByModerationLogID(ctx context.Context, moderationLogID int64) ([]Livecomment, error)
+	// CreateLivecomment 採番したIDをlivecomment.IDに設定する
+	CreateLivecomment(ctx context.Context, livecomment *Livecomment) error
+	// UpdateLivecomment コメント本文と編集時刻を更新する
+	UpdateLivecomment(ctx context.Context, livecomment *Livecomment) error
+	// HideLivecomments モデレーション操作でライブコメントを削除せずに非表示にする
+	HideLivecomments(ctx context.Context, ids []int64, hiddenAt int64, reason string, ngWordID sql.NullInt64, moderationLogID int64) error
+	// HideLivecommentByAuthor 投稿者自身による削除. モデレーションの記録は変更しない
+	HideLivecommentByAuthor(ctx context.Context, id int64, hiddenAt int64, reason string) error
+	// RestoreLivecomment 非表示を解除する. 非表示の理由は監査のために残す
+	RestoreLivecomment(ctx context.Context, id int64) error
+	// RestoreLivecommentsByModerationLogID モデレーション操作で非表示にした全てのライブコメントを再表示する
+	RestoreLivecommentsByModerationLogID(ctx context.Context, moderationLogID int64) error
+	// DeleteLivecomments 配信の全てのライブコメントを削除する
+	DeleteLivecomments(ctx context.Context, livestreamID int64) error
+	// GetTotalTip 全てのライブコメントのチップの合計
+	GetTotalTip(ctx context.Context) (int64, error)
+	// GetTipStats 配信のチップの合計と最大値
+	GetTipStats(ctx context.Context, livestreamID int64) (total int64, max int64, err error)
+
+	GetPinsByLivestreamIDs(ctx context.Context, livestreamIDs []int64) ([]LivestreamPin, error)
+	// UpsertPin 配信ごとに1つまでなので、既に固定されていれば置き換える
+	UpsertPin(ctx context.Context, pin *LivestreamPin) error
+	DeletePin(ctx context.Context, livestreamID int64) error
+
+	GetReportByID(ctx context.Context, id int64) (LivecommentReport, error)
+	GetReportForUpdate(ctx context.Context, id int64) (LivecommentReport, error)
+	// ListReports statusが空なら全ての状態の報告を返す
+	ListReports(ctx context.Context, livestreamID int64, status string) ([]LivecommentReport, error)
+	// CountOpenReporters ライブコメントに未対応の報告をしたユーザの数
+	CountOpenReporters(ctx context.Context, livecommentID int64) (int64, error)
+	// CreateReport 採番したIDをreport.IDに設定する. 同じユーザが既に報告していればErrDuplicate
+	CreateReport(ctx context.Context, report *LivecommentReport) error
+	// ResolveReports ライブコメントへの未対応の報告をまとめて解決する
+	ResolveReports(ctx context.Context, livecommentID int64, status, action string, resolvedBy, resolvedAt int64) error
+	// DeleteReports 配信のライブコメントへの全ての報告を削除する
+	DeleteReports(ctx context.Context, livestreamID int64) error
+}
+
+type ReactionRepository interface {
+	ListReactions(ctx context.Context, livestreamID int64, page Page) ([]Reaction, error)
+	// CreateReaction 採番したIDをreaction.IDに設定する
+	CreateReaction(ctx context.Context, reaction *Reaction) error
+	// DeleteReactions 配信の全てのリアクションを削除する
+	DeleteReactions(ctx context.Context, livestreamID int64) error
+	CountReactions(ctx context.Context, livestreamID int64) (int64, error)
+	// CountReactionsByStreamerID 配信者の全配信へのリアクションの数
+	CountReactionsByStreamerID(ctx context.Context, streamerID int64) (int64, error)
+	// GetFavoriteEmoji 配信者の全配信で最も多く使われた絵文字. リアクションがなければ空文字
+	GetFavoriteEmoji(ctx context.Context, streamerID int64) (string, error)
+}
+
+type ModerationRepository interface {
+	// GetModeratorPermissions 配信に対して有効な任命ごとの権限をカンマ区切りのまま返す
+	GetModeratorPermissions(ctx context.Context, streamerID, livestreamID, userID int64) ([]string, error)
+	// ListModerators 配信に対して有効なモデレーターを任命の順に返す
+	ListModerators(ctx context.Context, streamerID, livestreamID int64) ([]Moderator, error)
+	// UpsertModerator 同じ範囲で任命済みなら権限を置き換え、保存された行をmoderatorに設定する
+	UpsertModerator(ctx context.Context, moderator *Moderator) error
+	// DeleteModerator 配信に対して有効なモデレーターでなければfalseを返す
+	DeleteModerator(ctx context.Context, id, streamerID, livestreamID int64) (bool, error)
+	// DeleteLivestreamModerators 配信のみを範囲とするモデレーターを削除する
+	DeleteLivestreamModerators(ctx context.Context, livestreamID int64) error
+
+	// GetNGWordForUpdate 更新・削除が競合しないよう、NGワードをロックして返す
+	GetNGWordForUpdate(ctx context.Context, id int64) (NGWord, error)
+	// ListNGWords 配信に適用される全ての範囲のNGワードを新しい順に返す
+	ListNGWords(ctx context.Context, streamerID, livestreamID int64) ([]NGWord, error)
+	// ListNGWordsByScope 1つの範囲のNGワードのみを新しい順に返す. globalではstreamerIDとlivestreamIDを使わない
+	ListNGWordsByScope(ctx context.Context, scope string, streamerID, livestreamID int64) ([]NGWord, error)
+	// CreateNGWord 採番したIDをngWord.IDに設定する
+	CreateNGWord(ctx context.Context, ngWord *NGWord) error
+	// UpdateNGWord 語と一致方法を更新する. 範囲は変更できない
+	UpdateNGWord(ctx context.Context, ngWord *NGWord) error
+	DeleteNGWord(ctx context.Context, id int64) error
+	// DeleteGlobalNGWord 全体NGワードでなければfalseを返す
+	DeleteGlobalNGWord(ctx context.Context, id int64) (bool, error)
+	// DeleteLivestreamNGWords 配信のみを範囲とするNGワードを削除する
+	DeleteLivestreamNGWords(ctx context.Context, livestreamID int64) error
+
+	GetModerationLogForUpdate(ctx context.Context, id int64) (ModerationLog, error)
+	// ListModerationLogs 新しい順に返す
+	ListModerationLogs(ctx context.Context, livestreamID int64) ([]ModerationLog, error)
+	// CreateModerationLog 採番したIDをlog.IDに設定する
+	CreateModerationLog(ctx context.Context, log *ModerationLog) error
+	RevertModerationLog(ctx context.Context, id int64, revertedAt int64) error
+	// DeleteModerationLogs 配信のモデレーションの履歴を全て削除する
+	DeleteModerationLogs(ctx context.Context, livestreamID int64) error
+
+	// GetLivestreamSettings 設定されていなければErrNotFound
+	GetLivestreamSettings(ctx context.Context, livestreamID int64) (LivestreamSettings, error)
+	UpsertLivestreamSettings(ctx context.Context, settings *LivestreamSettings) error
+	DeleteLivestreamSettings(ctx context.Context, livestreamID int64) error
+
+	// ListActiveBans 配信に適用される、now時点で有効なBANを新しい順に返す
+	ListActiveBans(ctx context.Context, streamerID, livestreamID, now int64) ([]UserBan, error)
+	// ListActiveBansForUser ユーザに対する、配信に適用されるnow時点で有効なBANを返す
+	ListActiveBansForUser(ctx context.Context, userID, streamerID, livestreamID, now int64) ([]UserBan, error)
+	// CreateBan 採番したIDをban.IDに設定する
+	CreateBan(ctx context.Context, ban *UserBan) error
+	// DeleteBan 配信に適用されるBANでなければfalseを返す
+	DeleteBan(ctx context.Context, id, streamerID, livestreamID int64) (bool, error)
+	// DeleteLivestreamBans 配信のみを範囲とするBANを削除する
+	DeleteLivestreamBans(ctx context.Context, livestreamID int64) error
+}
+
+type ReservationRepository interface {
+	// ListSlots 範囲内の予約枠を開始時刻の順に返す. ロックはしない
+	ListSlots(ctx context.Context, startAt, endAt int64) ([]ReservationSlot, error)
+	// GetSlotsForUpdate 並列な予約のoverbookingを防ぐため、範囲と一部でも重なる予約枠をロックして返す
+	GetSlotsForUpdate(ctx context.Context, startAt, endAt int64) ([]ReservationSlot, error)
+	// DecrementSlots 範囲と一部でも重なる予約枠の残数を1つ減らす
+	DecrementSlots(ctx context.Context, startAt, endAt int64) error
+	// IncrementSlots 予約の取り消しで、範囲と一部でも重なる予約枠の残数を1つ戻す
+	IncrementSlots(ctx context.Context, startAt, endAt int64) error
+	// GetLastSlot 最も遅い時間の予約枠を返す. 予約枠がなければErrNotFound
+	GetLastSlot(ctx context.Context) (ReservationSlot, error)
+	// CreateSlots 予約枠を追加する
+	CreateSlots(ctx context.Context, slots []ReservationSlot) error
+}
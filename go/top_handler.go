@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/isucon/isucon13/webapp/go/store"
 	"github.com/isucon/isucon13/webapp/go/trace"
 	"github.com/labstack/echo/v4"
 )
@@ -14,10 +15,7 @@ type Tag struct {
 	Name string `json:"name"`
 }
 
-type TagModel struct {
-	ID   int64  `db:"id"`
-	Name string `db:"name"`
-}
+type TagModel = store.Tag
 
 type TagsResponse struct {
 	Tags []*Tag `json:"tags"`
@@ -28,14 +26,14 @@ func getTagHandler(c echo.Context) error {
 	trace.StartSpan(ctx, "getTagHandler")
 	defer trace.EndSpan(ctx, nil)
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin new transaction: : "+err.Error()+err.Error())
 	}
 	defer tx.Rollback()
 
-	var tagModels []*TagModel
-	if err := tx.SelectContext(ctx, &tagModels, "SELECT * FROM tags"); err != nil {
+	tagModels, err := tx.Livestreams().GetTags(ctx)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get tags: "+err.Error())
 	}
 
@@ -70,14 +68,13 @@ func getStreamerThemeHandler(c echo.Context) error {
 
 	username := c.Param("username")
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	tx, err := appStore.Begin(ctx)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
 	}
 	defer tx.Rollback()
 
-	userModel := UserModel{}
-	err = tx.GetContext(ctx, &userModel, "SELECT id FROM users WHERE name = ?", username)
+	userModel, err := tx.Users().GetUserByName(ctx, username)
 	if errors.Is(err, sql.ErrNoRows) {
 		return echo.NewHTTPError(http.StatusNotFound, "not found user that has the given username")
 	}
@@ -85,8 +82,8 @@ func getStreamerThemeHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
 	}
 
-	themeModel := ThemeModel{}
-	if err := tx.GetContext(ctx, &themeModel, "SELECT * FROM themes WHERE user_id = ?", userModel.ID); err != nil {
+	themeModel, err := tx.Users().GetTheme(ctx, userModel.ID)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user theme: "+err.Error())
 	}
 